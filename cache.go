@@ -0,0 +1,58 @@
+package sqldecoder
+
+import (
+	"reflect"
+	"sync"
+)
+
+// A TypeCache caches how the fields of struct types are mapped to columns, so
+// that each struct type is only inspected once. It is safe for concurrent use
+// by multiple decoders.
+type TypeCache struct {
+	m sync.Map // map[typeKey]*structMap
+}
+
+// typeKey identifies a mapping of a struct type's fields to columns.
+type typeKey struct {
+	t    reflect.Type
+	opts mapOptions
+}
+
+// defaultCache is the TypeCache used by decoders unless another is set with
+// UseCache.
+var defaultCache = NewTypeCache()
+
+// NewTypeCache returns an empty TypeCache.
+func NewTypeCache() *TypeCache {
+	return new(TypeCache)
+}
+
+// structMap provides the mapping of the fields of t to columns given opts. The
+// mapping is not cached when opts cannot be part of a key.
+func (c *TypeCache) structMap(t reflect.Type, opts mapOptions) (*structMap, error) {
+	if !reflect.ValueOf(opts).Comparable() {
+		return newStructMap(t, opts)
+	}
+
+	key := typeKey{t: t, opts: opts}
+	if sm, ok := c.m.Load(key); ok {
+		return sm.(*structMap), nil
+	}
+
+	sm, err := newStructMap(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := c.m.LoadOrStore(key, sm)
+	return actual.(*structMap), nil
+}
+
+// len provides the number of mappings in c.
+func (c *TypeCache) len() int {
+	n := 0
+	c.m.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
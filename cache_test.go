@@ -0,0 +1,157 @@
+package sqldecoder
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTypeCacheReusesMapping(t *testing.T) {
+	type record struct {
+		ID   int64
+		Name string
+	}
+	rt := reflect.TypeOf(record{})
+	opts := mapOptions{names: ExactNames, tags: SQLTags}
+
+	c := NewTypeCache()
+	first, err := c.structMap(rt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.structMap(rt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Errorf("got a new mapping, expected the cached mapping")
+	}
+	if n := c.len(); n != 1 {
+		t.Errorf("got %d mappings, expected 1", n)
+	}
+}
+
+func TestTypeCacheKeyedByOptions(t *testing.T) {
+	type record struct {
+		CreationTime string `db:"created"`
+	}
+	rt := reflect.TypeOf(record{})
+
+	c := NewTypeCache()
+	exact, err := c.structMap(rt, mapOptions{names: ExactNames, tags: SQLTags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snake, err := c.structMap(rt, mapOptions{names: SnakeCaseNames, tags: SQLTags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := c.structMap(rt, mapOptions{names: ExactNames, tags: DBTags})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := exact.fields["CreationTime"]; !ok {
+		t.Errorf("exact mapping is missing CreationTime")
+	}
+	if _, ok := snake.fields["creation_time"]; !ok {
+		t.Errorf("snake case mapping is missing creation_time")
+	}
+	if _, ok := db.fields["created"]; !ok {
+		t.Errorf("db mapping is missing created")
+	}
+	if n := c.len(); n != 3 {
+		t.Errorf("got %d mappings, expected 3", n)
+	}
+}
+
+func TestTypeCacheConcurrentUse(t *testing.T) {
+	type record struct {
+		ID   int64
+		Name string
+	}
+	rt := reflect.TypeOf(record{})
+	opts := mapOptions{names: ExactNames, tags: SQLTags}
+
+	c := NewTypeCache()
+	var wg sync.WaitGroup
+	maps := make([]*structMap, 8)
+	for i := range maps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sm, err := c.structMap(rt, opts)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			maps[i] = sm
+		}(i)
+	}
+	wg.Wait()
+
+	for _, sm := range maps[1:] {
+		if sm != maps[0] {
+			t.Fatalf("got different mappings, expected the same mapping")
+		}
+	}
+}
+
+// mapNameMapper is a NameMapper that is not comparable.
+type mapNameMapper struct {
+	columns map[string]string
+}
+
+func (m mapNameMapper) Field(name string) string {
+	if column, ok := m.columns[name]; ok {
+		return column
+	}
+	return name
+}
+
+func (m mapNameMapper) Column(name string) string {
+	return name
+}
+
+// funcTagParser is a TagParser that is not comparable.
+type funcTagParser func(reflect.StructTag) (Tag, error)
+
+func (f funcTagParser) ParseTag(tag reflect.StructTag) (Tag, error) {
+	return f(tag)
+}
+
+func TestTypeCacheSkipsIncomparableOptions(t *testing.T) {
+	type record struct {
+		CreationTime string `db:"created"`
+	}
+	rt := reflect.TypeOf(record{})
+
+	tests := []struct {
+		name     string
+		opts     mapOptions
+		expected string
+	}{
+		{"name mapper", mapOptions{names: mapNameMapper{columns: map[string]string{"CreationTime": "created_at"}}, tags: SQLTags}, "created_at"},
+		{"name mapper func", mapOptions{names: NameMapperFunc(strings.ToLower), tags: SQLTags}, "creationtime"},
+		{"tag parser", mapOptions{names: ExactNames, tags: funcTagParser(DBTags.ParseTag)}, "created"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewTypeCache()
+			for i := 0; i < 2; i++ {
+				sm, err := c.structMap(rt, tt.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := sm.fields[tt.expected]; !ok {
+					t.Errorf("mapping is missing %s", tt.expected)
+				}
+			}
+			if n := c.len(); n != 0 {
+				t.Errorf("got %d cached mappings, expected none", n)
+			}
+		})
+	}
+}
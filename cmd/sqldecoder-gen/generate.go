@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bhcleek/sqldecoder"
+)
+
+// directive marks the struct types for which methods are generated.
+const directive = "//sqldecoder:generate"
+
+// A column is a column mapped to a field of a struct.
+type column struct {
+	// name is the name of the column.
+	name string
+
+	// path is the Go selector of the field, such as Billing.Street.
+	path string
+
+	// depth is the depth of the field within the struct.
+	depth int
+
+	// tagged is true when the column is named by the field's tag.
+	tagged bool
+}
+
+// goName provides the name of c's struct field.
+func (c column) goName() string {
+	return c.path[strings.LastIndex(c.path, ".")+1:]
+}
+
+// A generator generates the methods of the marked struct types of a package.
+type generator struct {
+	fset *token.FileSet
+	tags sqldecoder.TagParser
+
+	// types holds the types declared in the package.
+	types map[string]ast.Expr
+
+	// scanners holds the types of the package that have a Scan method and
+	// are therefore decoded from a single column.
+	scanners map[string]bool
+
+	// idents holds the position of each identifier declared at package
+	// level, including the generated constants.
+	idents map[string]token.Pos
+}
+
+// generate provides the source of the file named output that implements the
+// methods of the marked struct types of the package in dir. The tags of the
+// structs' fields are parsed by tags.
+func generate(dir, output string, tags sqldecoder.TagParser) ([]byte, error) {
+	g := &generator{fset: token.NewFileSet(), tags: tags, types: make(map[string]ast.Expr), scanners: make(map[string]bool), idents: make(map[string]token.Pos)}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var pkg string
+	var marked []*ast.TypeSpec
+	for _, path := range paths {
+		if name := filepath.Base(path); name == output || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(g.fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if pkg == "" {
+			pkg = f.Name.Name
+		} else if f.Name.Name != pkg {
+			return nil, fmt.Errorf("found packages %s and %s in %s", pkg, f.Name.Name, dir)
+		}
+
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.ValueSpec:
+						for _, ident := range spec.Names {
+							g.idents[ident.Name] = ident.Pos()
+						}
+					case *ast.TypeSpec:
+						g.idents[spec.Name.Name] = spec.Name.Pos()
+						g.types[spec.Name.Name] = spec.Type
+						if hasDirective(spec.Doc) || (len(decl.Specs) == 1 && hasDirective(decl.Doc)) {
+							marked = append(marked, spec)
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					g.idents[decl.Name.Name] = decl.Name.Pos()
+				} else if decl.Name.Name == "Scan" {
+					if name, _ := typeName(decl.Recv.List[0].Type); name != "" {
+						g.scanners[name] = true
+					}
+				}
+			}
+		}
+	}
+	if pkg == "" {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	if len(marked) == 0 {
+		return nil, fmt.Errorf("no struct types in %s are marked with %s", dir, directive)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by sqldecoder-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import \"github.com/bhcleek/sqldecoder\"\n")
+	for _, ts := range marked {
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			return nil, g.errorf(ts.Pos(), "%s is marked with %s but is not a struct type", ts.Name.Name, directive)
+		}
+		columns, err := g.columns(ts.Name.Name, st)
+		if err != nil {
+			return nil, err
+		}
+		constants, err := g.constants(ts, columns)
+		if err != nil {
+			return nil, err
+		}
+		writeMethods(&buf, ts.Name.Name, columns, constants)
+	}
+	return format.Source(buf.Bytes())
+}
+
+// hasDirective reports whether doc contains the directive.
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName provides the name of the type expressed by x, which is a type name
+// or a pointer to one, and whether it is a pointer. The name is empty when x
+// is any other type, such as a type of another package.
+func typeName(x ast.Expr) (string, bool) {
+	ptr := false
+	if star, ok := x.(*ast.StarExpr); ok {
+		x, ptr = star.X, true
+	}
+	if ident, ok := x.(*ast.Ident); ok {
+		return ident.Name, ptr
+	}
+	return "", ptr
+}
+
+// errorf provides an error that describes the problem at pos.
+func (g *generator) errorf(pos token.Pos, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", g.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// columns provides the columns mapped to the fields of the struct type st,
+// which is named name, in the order of the fields.
+func (g *generator) columns(name string, st *ast.StructType) ([]column, error) {
+	all, err := g.structColumns(st, "", "", 1, map[string]bool{name: true})
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]column)
+	for _, c := range all {
+		byName[c.name] = append(byName[c.name], c)
+	}
+
+	var columns []column
+	for _, c := range all {
+		group, ok := byName[c.name]
+		if !ok {
+			continue
+		}
+		delete(byName, c.name)
+
+		dominant, ok, err := dominantColumn(group)
+		if err != nil {
+			return nil, g.errorf(st.Pos(), "%s: %s", name, err)
+		}
+		if ok {
+			columns = append(columns, dominant)
+		}
+	}
+	return columns, nil
+}
+
+// structColumns provides the columns mapped to the fields of st, including the
+// promoted fields of embedded structs and the fields of prefixed structs. path
+// is the Go selector of st, prefix is prepended to the column names of its
+// fields, depth is the depth of its fields, and visited holds the names of the
+// types that enclose it.
+func (g *generator) structColumns(st *ast.StructType, path, prefix string, depth int, visited map[string]bool) ([]column, error) {
+	var columns []column
+	for _, f := range st.Fields.List {
+		var tag string
+		if f.Tag != nil {
+			var err error
+			if tag, err = strconv.Unquote(f.Tag.Value); err != nil {
+				return nil, g.errorf(f.Tag.Pos(), "invalid tag: %s", err)
+			}
+		}
+		tg, err := g.tags.ParseTag(reflect.StructTag(tag))
+		if err != nil {
+			return nil, g.errorf(f.Pos(), "invalid tag: %s", err)
+		}
+		if tg.Ignore {
+			continue
+		}
+		opts := make([]string, 0, len(tg.Options))
+		for opt := range tg.Options {
+			opts = append(opts, opt)
+		}
+		sort.Strings(opts)
+		for _, opt := range opts {
+			if opt != "prefix" {
+				return nil, g.errorf(f.Pos(), "option %s is not supported", opt)
+			}
+		}
+
+		names := make([]string, len(f.Names))
+		for i, ident := range f.Names {
+			names[i] = ident.Name
+		}
+		embedded := len(names) == 0
+		if embedded {
+			switch x := f.Type.(type) {
+			case *ast.StarExpr:
+				names = append(names, selectorName(x.X))
+			default:
+				names = append(names, selectorName(x))
+			}
+		}
+
+		fieldPrefix, prefixed := tg.Options["prefix"]
+		if (embedded && tg.Name == "") || prefixed {
+			typ, ptr := typeName(f.Type)
+			nested, local := g.types[typ].(*ast.StructType)
+			switch {
+			case local && !g.scanners[typ]:
+				if ptr {
+					return nil, g.errorf(f.Pos(), "field %s is a pointer to a struct, which is not supported", names[0])
+				}
+				if !visited[typ] && (ast.IsExported(names[0]) || embedded) {
+					visited[typ] = true
+					nestedColumns, err := g.structColumns(nested, join(path, names[0]), prefix+fieldPrefix, depth+1, visited)
+					delete(visited, typ)
+					if err != nil {
+						return nil, err
+					}
+					columns = append(columns, nestedColumns...)
+				}
+				continue
+			case typ == "" && (prefixed || ast.IsExported(names[0])):
+				return nil, g.errorf(f.Pos(), "field %s has a type declared in another package, which is not supported", names[0])
+			case prefixed:
+				return nil, g.errorf(f.Pos(), "option prefix requires a struct field")
+			}
+		}
+
+		for _, name := range names {
+			if !ast.IsExported(name) {
+				continue
+			}
+			c := column{name: prefix + name, path: join(path, name), depth: depth}
+			if tg.Name != "" {
+				c.name = prefix + normalizeOccurrence(tg.Name)
+				c.tagged = true
+			}
+			columns = append(columns, c)
+		}
+	}
+	return columns, nil
+}
+
+// selectorName provides the name of the type x of an embedded field.
+func selectorName(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.IndexExpr:
+		return selectorName(x.X)
+	case *ast.IndexListExpr:
+		return selectorName(x.X)
+	}
+	return ""
+}
+
+// join provides the Go selector of the field name within the struct whose
+// selector is path.
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// normalizeOccurrence provides the column name name, which may name an
+// occurrence of a repeated column as in id#2, as the decoder names it. The
+// suffix of the first occurrence is removed.
+func normalizeOccurrence(name string) string {
+	i := strings.LastIndex(name, "#")
+	if i == -1 {
+		return name
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 1 {
+		return name
+	}
+	if n == 1 {
+		return name[:i]
+	}
+	return name[:i] + "#" + strconv.Itoa(n)
+}
+
+// dominantColumn provides the column that is mapped from among columns, which
+// all have the same name, following the decoder's rules: a shallower field
+// shadows deeper fields, a tagged field shadows untagged fields at the same
+// depth, fields with the same Go name are otherwise ambiguous and not mapped,
+// and fields with different Go names conflict.
+func dominantColumn(columns []column) (column, bool, error) {
+	depth := columns[0].depth
+	for _, c := range columns {
+		if c.depth < depth {
+			depth = c.depth
+		}
+	}
+	var dominant []column
+	for _, c := range columns {
+		if c.depth == depth {
+			dominant = append(dominant, c)
+		}
+	}
+	if len(dominant) == 1 {
+		return dominant[0], true, nil
+	}
+
+	var tagged []column
+	for _, c := range dominant {
+		if c.tagged {
+			tagged = append(tagged, c)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true, nil
+	}
+	if len(tagged) > 1 {
+		dominant = tagged
+	}
+
+	paths := make([]string, len(dominant))
+	ambiguous := true
+	for i, c := range dominant {
+		paths[i] = c.path
+		ambiguous = ambiguous && c.goName() == dominant[0].goName()
+	}
+	if ambiguous {
+		return column{}, false, nil
+	}
+	return column{}, false, errors.New("column " + dominant[0].name + " is mapped to fields " + strings.Join(paths, ", "))
+}
+
+// constants provides the names of the constants for columns, which are mapped
+// to the fields of the struct type declared by ts. A constant is named by the
+// type name, Column, and the field's selector without dots, as in
+// OrderColumnBillingStreet. An error is returned when a name is already
+// declared in the package or by another generated constant.
+func (g *generator) constants(ts *ast.TypeSpec, columns []column) ([]string, error) {
+	constants := make([]string, len(columns))
+	for i, c := range columns {
+		name := ts.Name.Name + "Column" + strings.ReplaceAll(c.path, ".", "")
+		if pos, ok := g.idents[name]; ok {
+			return nil, g.errorf(ts.Pos(), "constant %s for field %s.%s conflicts with the declaration at %s", name, ts.Name.Name, c.path, g.fset.Position(pos))
+		}
+		g.idents[name] = ts.Pos()
+		constants[i] = name
+	}
+	return constants, nil
+}
+
+// writeMethods writes the column name constants and the methods of the struct
+// type named name, whose fields are mapped to columns, to buf.
+func writeMethods(buf *bytes.Buffer, name string, columns []column, constants []string) {
+	fmt.Fprintf(buf, "\n// Column names of %s.\nconst (\n", name)
+	for i, c := range columns {
+		fmt.Fprintf(buf, "%s = %q\n", constants[i], c.name)
+	}
+	fmt.Fprintf(buf, ")\n")
+
+	fmt.Fprintf(buf, "\n// ColumnMap implements sqldecoder.ColumnMapper.\n")
+	fmt.Fprintf(buf, "func (v *%s) ColumnMap() sqldecoder.ColumnMap {\nreturn sqldecoder.ColumnMap{\n", name)
+	for i, c := range columns {
+		fmt.Fprintf(buf, "%s: &v.%s,\n", constants[i], c.path)
+	}
+	fmt.Fprintf(buf, "}\n}\n")
+
+	fmt.Fprintf(buf, "\n// ColumnIndex implements sqldecoder.ColumnIndexer.\n")
+	fmt.Fprintf(buf, "func (v *%s) ColumnIndex(name string) int {\nswitch name {\n", name)
+	for i := range columns {
+		fmt.Fprintf(buf, "case %s:\nreturn %d\n", constants[i], i)
+	}
+	fmt.Fprintf(buf, "}\nreturn -1\n}\n")
+
+	fmt.Fprintf(buf, "\n// ScanDest implements sqldecoder.ColumnIndexer.\n")
+	fmt.Fprintf(buf, "func (v *%s) ScanDest(i int) interface{} {\nswitch i {\n", name)
+	for i, c := range columns {
+		fmt.Fprintf(buf, "case %d:\nreturn &v.%s\n", i, c.path)
+	}
+	fmt.Fprintf(buf, "}\nreturn nil\n}\n")
+}
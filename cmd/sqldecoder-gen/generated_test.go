@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bhcleek/sqldecoder"
+	"github.com/bhcleek/sqldecoder/cmd/sqldecoder-gen/testdata/models"
+	"github.com/erikstmartin/go-testdb"
+)
+
+// reflectedCustomer has the fields of models.Customer without its generated
+// methods, so that it is decoded by reflection.
+type reflectedCustomer models.Customer
+
+// mappedCustomer decodes a models.Customer through its generated ColumnMap
+// method alone.
+type mappedCustomer struct {
+	c *models.Customer
+}
+
+func (m mappedCustomer) ColumnMap() sqldecoder.ColumnMap {
+	return m.c.ColumnMap()
+}
+
+// TestGeneratedMatchesReflection decodes the same rows through the generated
+// methods of the testdata package and through reflection, which must agree.
+func TestGeneratedMatchesReflection(t *testing.T) {
+	defer testdb.Reset()
+
+	db, err := sql.Open("testdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []string{"created_at", "Description", "id", "id", "name", "description", "Status", "billing_Street", "billing_City", "shipping_Street", "shipping_City", "Notes", "internal", "unmapped"}
+	data := [][]driver.Value{
+		{time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC), "audited", 1, 2, "Ada", "first", "active", "1 Main St", "Springfield", "2 Side St", "Shelbyville", "ignored", "hidden", "extra"},
+		{time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC), "", 3, 4, "Grace", "second", "closed", "", "", "3 Elm St", "Capital City", "", "", ""},
+	}
+	// query stubs a query that returns the rows and provides them. Each
+	// query has its own driver.Rows.
+	query := func(name string) *sql.Rows {
+		q := "SELECT * FROM " + name
+		testdb.StubQuery(q, &stubRows{columns: columns, data: data})
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	for _, decode := range []struct {
+		name string
+		dest func(*models.Customer) interface{}
+	}{
+		{"ColumnIndexer", func(c *models.Customer) interface{} { return c }},
+		{"ColumnMapper", func(c *models.Customer) interface{} { return mappedCustomer{c: c} }},
+	} {
+		t.Run(decode.name, func(t *testing.T) {
+			generated := sqldecoder.NewDecoder(query(decode.name + "_generated"))
+			reflected := sqldecoder.NewDecoder(query(decode.name + "_reflected"))
+
+			for row := 0; ; row++ {
+				var g models.Customer
+				var r reflectedCustomer
+				gerr := generated.Decode(decode.dest(&g))
+				rerr := reflected.Decode(&r)
+				if gerr != rerr {
+					t.Fatalf("row %d: got %v from the generated methods and %v from reflection", row, gerr, rerr)
+				}
+				if gerr == io.EOF {
+					if row != 2 {
+						t.Errorf("got %d rows, expected 2", row)
+					}
+					return
+				}
+				if gerr != nil {
+					t.Fatalf("row %d: Decode failed: %s", row, gerr)
+				}
+
+				if !reflect.DeepEqual(g, models.Customer(r)) {
+					t.Errorf("row %d: got %+v from the generated methods and %+v from reflection", row, g, models.Customer(r))
+				}
+				if g.ID == 0 || g.ParentID == 0 || g.Status.Name == "" || g.Shipping.City == "" {
+					t.Errorf("row %d: got %+v, expected every column to be decoded", row, g)
+				}
+			}
+		})
+	}
+}
+
+// stubRows is a driver.Rows to be used by the testdb driver.
+type stubRows struct {
+	columns []string
+	data    [][]driver.Value
+	next    int
+}
+
+func (r *stubRows) Columns() []string {
+	return r.columns
+}
+
+func (r *stubRows) Close() error {
+	return nil
+}
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.next == len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,64 @@
+// Sqldecoder-gen generates implementations of sqldecoder.ColumnMapper and
+// sqldecoder.ColumnIndexer, so that rows can be decoded into structs without
+// reflection.
+//
+// Usage:
+//
+//	sqldecoder-gen [-dir dir] [-output file] [-tag key]
+//
+// It is intended to be run by go generate, as in
+//
+//	//go:generate sqldecoder-gen
+//
+// Methods are generated for the struct types of the package in dir whose
+// documentation contains the directive
+//
+//	//sqldecoder:generate
+//
+// along with a constant for the name of each column, named by the type name,
+// Column and the field's selector without dots, as in CustomerColumnName. An
+// error is reported when a constant's name is already declared. The fields
+// are mapped to columns by the same rules as the decoder's, using the tags
+// with the given key: the fields of embedded structs are promoted, the fields
+// of a struct field with a prefix option are mapped to prefixed columns, and
+// a field tagged "-" is ignored. Types are resolved without type checking, so
+// embedded structs and prefixed struct fields must be declared in the same
+// package and must not be pointers. The other tag options change how a row is
+// decoded at run time and are not supported.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bhcleek/sqldecoder"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("sqldecoder-gen: ")
+
+	dir := flag.String("dir", ".", "directory of the package")
+	output := flag.String("output", "sqldecoder_gen.go", "name of the generated file within dir")
+	tag := flag.String("tag", "sql", "key of the struct tags that name columns")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: sqldecoder-gen [-dir dir] [-output file] [-tag key]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := generate(*dir, *output, sqldecoder.TagKey(*tag))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(*dir, *output), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhcleek/sqldecoder"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("testdata", "models")
+	actual, err := generate(dir, "sqldecoder_gen.go", sqldecoder.SQLTags)
+	if err != nil {
+		t.Fatalf("generate failed: %s", err)
+	}
+
+	golden := filepath.Join(dir, "sqldecoder_gen.go")
+	if *update {
+		if err := os.WriteFile(golden, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(actual) != string(expected) {
+		t.Errorf("got:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "unsupported option",
+			src: `type T struct {
+	Name string ` + "`sql:\"name,nullzero\"`" + `
+}`,
+			expected: "option nullzero is not supported",
+		},
+		{
+			name: "pointer to prefixed struct",
+			src: `type Address struct{ Street string }
+
+type T struct {
+	Billing *Address ` + "`sql:\",prefix=billing_\"`" + `
+}`,
+			expected: "field Billing is a pointer to a struct",
+		},
+		{
+			name: "embedded type of another package",
+			src: `type T struct {
+	sql.NullString
+}`,
+			expected: "field NullString has a type declared in another package",
+		},
+		{
+			name: "conflicting fields",
+			src: `type T struct {
+	Natural int64 ` + "`sql:\"ID\"`" + `
+	Other   int64 ` + "`sql:\"ID\"`" + `
+}`,
+			expected: "column ID is mapped to fields Natural, Other",
+		},
+		{
+			name: "constant conflicts with declaration",
+			src: `type TColumnStatus string
+
+type T struct {
+	Status TColumnStatus
+}`,
+			expected: "constant TColumnStatus for field T.Status conflicts with the declaration at",
+		},
+		{
+			name: "constants of marked types conflict",
+			src: `type T struct {
+	ColumnX int64
+}
+
+//sqldecoder:generate
+type TColumn struct {
+	X int64
+}`,
+			expected: "constant TColumnColumnX for field TColumn.X conflicts with the declaration at",
+		},
+		{
+			name:     "not a struct",
+			src:      `type T int`,
+			expected: "T is marked with //sqldecoder:generate but is not a struct type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := "package p\n\nimport \"database/sql\"\n\nvar _ sql.NullString\n\n" + strings.Replace(tt.src, "type T ", "//sqldecoder:generate\ntype T ", 1) + "\n"
+			if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := generate(dir, "sqldecoder_gen.go", sqldecoder.SQLTags)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("got error %v, expected it to contain %q", err, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Audit records when a row was created.
+type Audit struct {
+	CreationTime time.Time `sql:"created_at"`
+	Description  string
+}
+
+// Address is mapped to prefixed columns.
+type Address struct {
+	Street string
+	City   string
+}
+
+// Status is decoded from a single column.
+type Status struct {
+	Name string
+}
+
+// Scan implements sql.Scanner.
+func (s *Status) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case string:
+		s.Name = src
+	case []byte:
+		s.Name = string(src)
+	}
+	return nil
+}
+
+// Customer is decoded without reflection.
+//
+//sqldecoder:generate
+type Customer struct {
+	Audit
+	ID          int64  `sql:"id"`
+	ParentID    int64  `sql:"id#2"`
+	Name        string `sql:"name"`
+	Description string `sql:"description"`
+	Status      Status
+	Billing     Address `sql:",prefix=billing_"`
+	Shipping    Address `sql:",prefix=shipping_"`
+	Notes       string  `sql:"-"`
+	internal    string
+}
+
+type (
+	// Order is decoded without reflection.
+	//
+	//sqldecoder:generate
+	Order struct {
+		ID    int64 `sql:"id"`
+		Total float64
+	}
+
+	// Ignored is not marked.
+	Ignored struct {
+		ID int64
+	}
+)
@@ -0,0 +1,131 @@
+// Code generated by sqldecoder-gen. DO NOT EDIT.
+
+package models
+
+import "github.com/bhcleek/sqldecoder"
+
+// Column names of Customer.
+const (
+	CustomerColumnAuditCreationTime = "created_at"
+	CustomerColumnAuditDescription  = "Description"
+	CustomerColumnID                = "id"
+	CustomerColumnParentID          = "id#2"
+	CustomerColumnName              = "name"
+	CustomerColumnDescription       = "description"
+	CustomerColumnStatus            = "Status"
+	CustomerColumnBillingStreet     = "billing_Street"
+	CustomerColumnBillingCity       = "billing_City"
+	CustomerColumnShippingStreet    = "shipping_Street"
+	CustomerColumnShippingCity      = "shipping_City"
+)
+
+// ColumnMap implements sqldecoder.ColumnMapper.
+func (v *Customer) ColumnMap() sqldecoder.ColumnMap {
+	return sqldecoder.ColumnMap{
+		CustomerColumnAuditCreationTime: &v.Audit.CreationTime,
+		CustomerColumnAuditDescription:  &v.Audit.Description,
+		CustomerColumnID:                &v.ID,
+		CustomerColumnParentID:          &v.ParentID,
+		CustomerColumnName:              &v.Name,
+		CustomerColumnDescription:       &v.Description,
+		CustomerColumnStatus:            &v.Status,
+		CustomerColumnBillingStreet:     &v.Billing.Street,
+		CustomerColumnBillingCity:       &v.Billing.City,
+		CustomerColumnShippingStreet:    &v.Shipping.Street,
+		CustomerColumnShippingCity:      &v.Shipping.City,
+	}
+}
+
+// ColumnIndex implements sqldecoder.ColumnIndexer.
+func (v *Customer) ColumnIndex(name string) int {
+	switch name {
+	case CustomerColumnAuditCreationTime:
+		return 0
+	case CustomerColumnAuditDescription:
+		return 1
+	case CustomerColumnID:
+		return 2
+	case CustomerColumnParentID:
+		return 3
+	case CustomerColumnName:
+		return 4
+	case CustomerColumnDescription:
+		return 5
+	case CustomerColumnStatus:
+		return 6
+	case CustomerColumnBillingStreet:
+		return 7
+	case CustomerColumnBillingCity:
+		return 8
+	case CustomerColumnShippingStreet:
+		return 9
+	case CustomerColumnShippingCity:
+		return 10
+	}
+	return -1
+}
+
+// ScanDest implements sqldecoder.ColumnIndexer.
+func (v *Customer) ScanDest(i int) interface{} {
+	switch i {
+	case 0:
+		return &v.Audit.CreationTime
+	case 1:
+		return &v.Audit.Description
+	case 2:
+		return &v.ID
+	case 3:
+		return &v.ParentID
+	case 4:
+		return &v.Name
+	case 5:
+		return &v.Description
+	case 6:
+		return &v.Status
+	case 7:
+		return &v.Billing.Street
+	case 8:
+		return &v.Billing.City
+	case 9:
+		return &v.Shipping.Street
+	case 10:
+		return &v.Shipping.City
+	}
+	return nil
+}
+
+// Column names of Order.
+const (
+	OrderColumnID    = "id"
+	OrderColumnTotal = "Total"
+)
+
+// ColumnMap implements sqldecoder.ColumnMapper.
+func (v *Order) ColumnMap() sqldecoder.ColumnMap {
+	return sqldecoder.ColumnMap{
+		OrderColumnID:    &v.ID,
+		OrderColumnTotal: &v.Total,
+	}
+}
+
+// ColumnIndex implements sqldecoder.ColumnIndexer.
+func (v *Order) ColumnIndex(name string) int {
+	switch name {
+	case OrderColumnID:
+		return 0
+	case OrderColumnTotal:
+		return 1
+	}
+	return -1
+}
+
+// ScanDest implements sqldecoder.ColumnIndexer.
+func (v *Order) ScanDest(i int) interface{} {
+	switch i {
+	case 0:
+		return &v.ID
+	case 1:
+		return &v.Total
+	}
+	return nil
+}
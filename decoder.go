@@ -1,163 +1,733 @@
 package sqldecoder
 
 import (
+	"errors"
 	"io"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-type typeMap map[reflect.Type]map[string]int
-
 // A Decoder reads and decodes values from rows.
 type Decoder struct {
 	rows Rows
 	d    decodeState
+
+	// autoClose causes the rows to be closed when Decode returns an error.
+	autoClose bool
+
+	// decodingResultSets defers closing the rows until DecodeResultSets
+	// has decoded every result set.
+	decodingResultSets bool
+
+	// row is the number of rows that have been advanced to.
+	row int
+
+	// err is the error that ended the iteration of the rows.
+	err error
+
+	// collectRowErrors causes DecodeAll to skip the rows that cannot be
+	// scanned, until maxRowErrors rows have been skipped when it is
+	// positive.
+	collectRowErrors bool
+	maxRowErrors     int
 }
 
 type decodeState struct {
-	tm typeMap
-	s  Scanner
+	cache *TypeCache
+	s     Scanner
+
+	// plan is the plan compiled for the columns and destinations of the
+	// previous row.
+	plan *plan
+
+	// opts determines how struct fields are mapped to columns.
+	opts mapOptions
+
+	// nullZero causes NULL columns to be decoded as the zero value of
+	// destinations into which NULL cannot be scanned.
+	nullZero bool
+
+	// disallowUnknownColumns causes an error when a column has no
+	// destination.
+	disallowUnknownColumns bool
+
+	// requireAllFields causes an error when a field has no column, as if
+	// every field were tagged with the required option.
+	requireAllFields bool
+
+	// bytesAsStrings causes []byte values scanned into an interface{} map
+	// element to be stored as strings.
+	bytesAsStrings bool
+}
+
+// An UnmarshalTypeError describes a destination whose type cannot be decoded
+// into.
+type UnmarshalTypeError struct {
+	// Type is the type of the destination, which is nil when the
+	// destination is nil.
+	Type reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Type == nil {
+		return "Cannot unmarshal into nil"
+	}
+	return "Cannot unmarshal into value of type " + e.Type.String()
+}
+
+// A FieldError describes a column that could not be scanned into its
+// destination.
+type FieldError struct {
+	// Column is the name of the column and ColumnIndex is its index in the
+	// result set.
+	Column      string
+	ColumnIndex int
+
+	// Field is the Go selector of the struct field into which the column
+	// is decoded, such as Order.Total. It is empty when the destination is
+	// not a struct field.
+	Field string
+
+	// Type is the type of the destination.
+	Type reflect.Type
+
+	// Row is the index of the row, counting from zero, or -1 when the row
+	// was not read by a Decoder.
+	Row int
+
+	// Err is the error that occurred while scanning the column.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	s := "column " + e.Column
+	if e.Row >= 0 {
+		s = "row " + strconv.Itoa(e.Row) + ", " + s
+	}
+	switch {
+	case e.Field != "":
+		s += " → " + e.Field
+	case e.Type != nil:
+		s += " → " + e.Type.String()
+	}
+	return s + ": " + e.Err.Error()
 }
 
-type unmarshalTypeError struct {
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// A RowError describes a row that was skipped because it could not be
+// decoded.
+type RowError struct {
+	// Row is the index of the row, counting from zero.
+	Row int
+
+	// Values holds the values of the row's columns as they were provided
+	// by the driver. It is nil when the values could not be scanned.
+	Values []interface{}
+
+	// Err is the error that occurred while decoding the row.
+	Err error
+}
+
+func (e *RowError) Error() string {
+	var fe *FieldError
+	if errors.As(e.Err, &fe) && fe.Row == e.Row {
+		return e.Err.Error()
+	}
+	return "row " + strconv.Itoa(e.Row) + ": " + e.Err.Error()
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// RowErrors holds the errors of the rows that were skipped by DecodeAll after
+// CollectRowErrors was called.
+type RowErrors []*RowError
+
+func (e RowErrors) Error() string {
+	if len(e) == 0 {
+		return "No rows were skipped"
+	}
+	s := "Cannot decode " + strconv.Itoa(len(e)) + " rows: " + e[0].Error()
+	if len(e) > 1 {
+		s += " (and " + strconv.Itoa(len(e)-1) + " more)"
+	}
+	return s
+}
+
+// Unwrap returns the errors of the rows, so that errors.Is and errors.As
+// examine each of them.
+func (e RowErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, re := range e {
+		errs[i] = re
+	}
+	return errs
+}
+
+type columnCountError struct {
 	rt reflect.Type
+	n  int
+}
+
+func (e columnCountError) Error() string {
+	return "Cannot unmarshal " + strconv.Itoa(e.n) + " columns into value of type " + e.rt.String()
+}
+
+type unknownColumnsError struct {
+	columns []string
+}
+
+func (e unknownColumnsError) Error() string {
+	return "Cannot decode columns that have no destination: " + strings.Join(e.columns, ", ")
+}
+
+type missingColumnsError struct {
+	rt     reflect.Type
+	fields []string
 }
 
-func (e unmarshalTypeError) Error() string {
-	return "Cannot unmarshal into value of type " + e.rt.String()
+func (e missingColumnsError) Error() string {
+	return "Cannot unmarshal into value of type " + e.rt.String() + " without columns for fields: " + strings.Join(e.fields, ", ")
 }
 
+type requireIndexerError struct {
+	rt reflect.Type
+}
+
+func (e requireIndexerError) Error() string {
+	return "Cannot require all fields of value of type " + e.rt.String() + ", which is a ColumnIndexer but not a ColumnMapper"
+}
+
+type resultSetCountError struct {
+	n, want int
+}
+
+func (e resultSetCountError) Error() string {
+	return "Cannot decode " + strconv.Itoa(e.n) + " result sets into " + strconv.Itoa(e.want) + " destinations"
+}
+
+// errNoDestinations is returned when a row is decoded into no destinations.
+var errNoDestinations = errors.New("Cannot decode a row without destinations")
+
 // NewDecoder returns a new decoder that reads from rows.
 func NewDecoder(rows Rows) *Decoder {
-	d := decodeState{tm: make(typeMap), s: rows}
+	d := decodeState{cache: defaultCache, s: rows, opts: mapOptions{names: ExactNames, tags: SQLTags}}
 	decoder := &Decoder{rows: rows, d: d}
 	return decoder
 }
 
-// fieldMap provides a map whose keys are a column name and whose values are
-// the field index. The column name for a given exported field is (in priority
-// order):
-// 		the value of a sql tag on on the field
-//		the field name
-func fieldMap(t reflect.Type) map[string]int {
-	if t.Kind() != reflect.Struct {
+// mapEntry provides a temporary into which the column col can be scanned and
+// a setter that stores the scanned value in the map m.
+func (ds *decodeState) mapEntry(m reflect.Value, col string) (interface{}, func() error) {
+	key := reflect.ValueOf(col).Convert(m.Type().Key())
+	et := m.Type().Elem()
+	if ds.nullZero && !acceptsNull(et) {
+		tmp := reflect.New(reflect.PtrTo(et))
+		return tmp.Interface(), func() error {
+			if tmp.Elem().IsNil() {
+				m.SetMapIndex(key, reflect.Zero(et))
+			} else {
+				m.SetMapIndex(key, tmp.Elem().Elem())
+			}
+			return nil
+		}
+	}
+
+	tmp := reflect.New(et)
+	return tmp.Interface(), func() error {
+		m.SetMapIndex(key, ds.mapValue(tmp.Elem()))
 		return nil
 	}
+}
 
-	fm := make(map[string]int)
-	tagged := make(map[string]bool)
-	for i := 0; i < t.NumField(); i++ {
-		ft := t.Field(i)
-		colName := ft.Tag.Get("sql")
-		if colName != "" {
-			fm[colName] = i
-			tagged[colName] = true
-			continue
+// mapValue provides the value to be stored in a map from the scanned value v.
+func (ds *decodeState) mapValue(v reflect.Value) reflect.Value {
+	if ds.bytesAsStrings && v.Kind() == reflect.Interface {
+		if b, ok := v.Interface().([]byte); ok {
+			return reflect.ValueOf(string(b))
 		}
+	}
+	return v
+}
 
-		colName = ft.Name
-		if _, ok := tagged[colName]; !ok {
-			fm[colName] = i
-			tagged[colName] = false
+// prefixed is a destination whose columns are named with a prefix.
+type prefixed struct {
+	prefix string
+	v      interface{}
+}
+
+// Prefix returns a destination for Decode and Unmarshal that decodes the
+// columns whose names begin with prefix into v. The prefix is removed from the
+// column names before they are mapped to v.
+func Prefix(prefix string, v interface{}) interface{} {
+	return &prefixed{prefix: prefix, v: v}
+}
+
+// fields provides the destinations into which each column should be scanned
+// and the setters to call once the row has been scanned. The columns are
+// offered to each destination in v in turn, and each column is scanned into
+// the first destination that maps it. A destination returned by Prefix is
+// only offered the columns whose names begin with its prefix. The key of a
+// column offered to a destination reflects the occurrences of its name among
+// the columns offered to the destination.
+//
+// The mapping of columns to destinations is compiled into a plan on the first
+// row and reused until the columns or the types of the destinations change.
+func (ds *decodeState) fields(v ...interface{}) ([]interface{}, []func() error, error) {
+	cols, err := ds.s.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ds.plan.matches(cols, v) {
+		p, err := ds.compile(cols, v)
+		if err != nil {
+			return nil, nil, err
 		}
+		ds.plan = p
 	}
-
-	return fm
+	return ds.bind(ds.plan, v)
 }
 
-// columnMapFromTags uses tags to provide a ColumnMap. The column name for a
-// given exported field is (in priority order):
-// 	the value of a sql tag on the field
-// 	the field name
-func (ds *decodeState) columnMapFromTags(v interface{}) (ColumnMap, error) {
-	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return nil, unmarshalTypeError{rt: rv.Type()}
+// requireColumns returns an error if a key in cm, which was provided by a
+// value of type rt, is not one of keys.
+func requireColumns(rt reflect.Type, cm ColumnMap, keys []string) error {
+	present := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		present[key] = true
 	}
-	dst := rv.Elem()
 
-	var cm ColumnMap
-	switch dst.Kind() {
-	case reflect.Struct:
-		tfm, ok := ds.tm[dst.Type()]
-		if !ok {
-			tfm = fieldMap(dst.Type())
-			ds.tm[dst.Type()] = tfm
+	var missing []string
+	for key := range cm {
+		if !present[key] {
+			missing = append(missing, key)
 		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return missingColumnsError{rt: rt, fields: missing}
+	}
+	return nil
+}
 
-		cols, err := ds.s.Columns()
-		if err != nil {
-			return nil, err
+// columnKeys provides the key of each of cols by which the column is mapped to
+// a destination. The key is the column name, followed by #n for the nth
+// occurrence of a name that is repeated, as in id#2.
+func columnKeys(cols []string) []string {
+	keys := make([]string, len(cols))
+	seen := make(map[string]int, len(cols))
+	for i, col := range cols {
+		seen[col]++
+		if n := seen[col]; n > 1 {
+			keys[i] = col + "#" + strconv.Itoa(n)
+		} else {
+			keys[i] = col
 		}
+	}
+	return keys
+}
 
-		cm = make(map[string]interface{}, len(cols))
-		for _, col := range cols {
-			if fi, ok := tfm[col]; ok {
-				if fv := dst.Field(fi); fv.CanSet() {
-					cm[col] = fv.Addr().Interface()
-				}
+// unmarshal gets the data from the scanner and stores it in the values pointed to by v.
+func (ds *decodeState) unmarshal(row int, v ...interface{}) error {
+	if len(v) == 0 {
+		return errNoDestinations
+	}
+
+	fields, setters, err := ds.fields(v...)
+	if err != nil {
+		return err
+	}
+
+	return ds.scan(row, fields, setters)
+}
+
+// scan scans the current row, whose index is row, into fields and calls the
+// setters once the row has been scanned. A NULL column that a setter cannot
+// store is reported as the error of scanning it into its field.
+func (ds *decodeState) scan(row int, fields []interface{}, setters []func() error) error {
+	if err := ds.s.Scan(fields...); err != nil {
+		return ds.fieldError(row, fields, err)
+	}
+	for _, set := range setters {
+		if err := set(); err != nil {
+			if ne, ok := err.(nullColumnError); ok {
+				fields[ne.col] = reflect.New(ne.typ).Interface()
+				return ds.fieldError(row, fields, err)
 			}
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlScanErrorPrefix begins the errors with which *sql.Rows wraps the error
+// of scanning a column, which repeat the column's index and name.
+const sqlScanErrorPrefix = "sql: Scan error on column index "
+
+// fieldError provides a FieldError for the column that caused the scan of the
+// row whose index is row into fields to fail with err. The column is found by
+// scanning each column alone, and err is returned if no column fails alone.
+// The cause of an error wrapped by *sql.Rows is recorded without the wrapper;
+// other errors are recorded as they are.
+func (ds *decodeState) fieldError(row int, fields []interface{}, err error) error {
+	cols, cerr := ds.s.Columns()
+	if cerr != nil || len(cols) != len(fields) {
+		return err
+	}
+
+	dests := make([]interface{}, len(fields))
+	for i := range dests {
+		dests[i] = new(interface{})
+	}
+	for i, fd := range fields {
+		sink := dests[i]
+		dests[i] = fd
+		ferr := ds.s.Scan(dests...)
+		dests[i] = sink
+		if ferr == nil {
+			continue
 		}
 
-	default:
-		return nil, unmarshalTypeError{rt: dst.Type()}
+		fe := &FieldError{Column: cols[i], ColumnIndex: i, Row: row, Err: ferr}
+		if cause := errors.Unwrap(ferr); cause != nil && strings.HasPrefix(ferr.Error(), sqlScanErrorPrefix) {
+			fe.Err = cause
+		}
+		if ds.plan != nil && ds.plan.targets[i].typ != nil {
+			fe.Field, fe.Type = ds.plan.targets[i].path, ds.plan.targets[i].typ
+		} else if rt := reflect.TypeOf(fd); rt != nil && rt.Kind() == reflect.Ptr {
+			fe.Type = rt.Elem()
+		}
+		return fe
 	}
-	return cm, nil
+	return err
 }
 
-func (ds *decodeState) fields(v interface{}) ([]interface{}, error) {
-	var mappedFields ColumnMap
-	var err error
-	if fm, ok := v.(ColumnMapper); ok {
-		mappedFields = fm.ColumnMap()
-	} else {
-		mappedFields, err = ds.columnMapFromTags(v)
-		if err != nil {
-			return nil, err
+// Decode the next row into v. Each value in v is expected to be a pointer to a
+// struct, a pointer to a map whose keys are strings, a pointer to a scalar
+// value, or a destination returned by Prefix. A pointer to a scalar value
+// requires exactly one column when it is the only destination. When there are
+// several destinations, each column is decoded into the first destination
+// that maps it. An error is returned without reading a row when v is empty.
+// Returns io.EOF if there are no more rows to decode. When the rows have an
+// Err method, as *sql.Rows does, the error that ended the iteration of the rows
+// is returned instead of io.EOF.
+func (d *Decoder) Decode(v ...interface{}) error {
+	if d.rows == nil {
+		return io.EOF
+	}
+	if len(v) == 0 {
+		if d.autoClose {
+			d.Close()
 		}
+		return errNoDestinations
 	}
-	cols, err := ds.s.Columns()
-	if err != nil {
-		return nil, err
+
+	if !d.Next() {
+		if d.err != nil {
+			return d.err
+		}
+		return io.EOF
+	}
+	err := d.d.unmarshal(d.RowIndex(), v...)
+	if err != nil && d.autoClose {
+		d.Close()
 	}
+	return err
+}
 
-	fields := make([]interface{}, len(cols))
-	for i, v := range cols {
-		if fieldDest, ok := mappedFields[v]; ok {
-			fields[i] = fieldDest
-		} else {
-			fields[i] = new(interface{})
+// Next advances to the next row, which is then decoded by Scan. It returns
+// false when there are no more rows or when an error occurred while advancing,
+// which is reported by Err.
+func (d *Decoder) Next() bool {
+	if d.rows == nil || !d.rows.Next() {
+		d.end()
+		return false
+	}
+	d.row++
+	return true
+}
+
+// end records the error that ended the iteration of the rows and closes the
+// rows when AutoClose was called.
+func (d *Decoder) end() {
+	if er, ok := d.rows.(interface{ Err() error }); ok && d.err == nil {
+		d.err = er.Err()
+	}
+	if d.decodingResultSets && d.err == nil {
+		// DecodeResultSets closes the rows once it has decoded every
+		// result set.
+		return
+	}
+	d.close()
+}
+
+// close closes the rows when AutoClose was called.
+func (d *Decoder) close() {
+	if d.autoClose {
+		if err := d.Close(); err != nil && d.err == nil {
+			d.err = err
 		}
 	}
-	return fields, nil
 }
 
-// unmarshal gets the data from the scanner and stores it in the value pointed to by v.
-func (ds *decodeState) unmarshal(v interface{}) error {
-	fields, err := ds.fields(v)
-	if err != nil {
-		return err
+// NextResultSet prepares the next result set for decoding. It reports whether
+// there is a next result set, which is false when the rows have no
+// NextResultSet method. When it returns false, Err reports the error, if any,
+// that prevented advancing to the next result set. As with *sql.Rows, Next
+// must be called before the first row of the next result set is scanned,
+// which Decode does.
+func (d *Decoder) NextResultSet() bool {
+	d.d.plan = nil
+	d.row = 0
+
+	rs, ok := d.rows.(resultSetRows)
+	if !ok {
+		return false
 	}
+	if !rs.NextResultSet() {
+		if er, ok := d.rows.(interface{ Err() error }); ok && d.err == nil {
+			d.err = er.Err()
+		}
+		d.close()
+		return false
+	}
+	return true
+}
+
+// DecodeResultSets decodes the rows of each remaining result set into the
+// corresponding slice in v, as DecodeAll does. An error is returned when
+// there are fewer result sets than slices; result sets beyond the slices are
+// not decoded.
+func (d *Decoder) DecodeResultSets(v ...interface{}) error {
+	d.decodingResultSets = true
+	err := d.decodeResultSets(v...)
+	d.decodingResultSets = false
 
-	return ds.s.Scan(fields...)
+	d.close()
+	if err == nil {
+		err = d.err
+	}
+	return err
 }
 
-// Decode the next row into v. v is expected to be a struct.
-// Returns io.EOF if there are no more rows to decode.
-func (d *Decoder) Decode(v interface{}) error {
+// decodeResultSets decodes the rows of each remaining result set into the
+// corresponding slice in v.
+func (d *Decoder) decodeResultSets(v ...interface{}) error {
+	for i, dst := range v {
+		if i > 0 && !d.NextResultSet() {
+			if d.err != nil {
+				return d.err
+			}
+			return resultSetCountError{n: i, want: len(v)}
+		}
+		if err := d.DecodeAll(dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scan decodes the current row, which Next advanced to, into v as Decode does.
+// As with Decode, the rows are closed when Scan returns an error after
+// AutoClose was called.
+func (d *Decoder) Scan(v ...interface{}) error {
 	if d.rows == nil {
 		return io.EOF
 	}
+	err := d.d.unmarshal(d.RowIndex(), v...)
+	if err != nil && d.autoClose {
+		d.Close()
+	}
+	return err
+}
 
-	if ok := d.rows.Next(); ok {
-		if err := d.d.unmarshal(v); err != nil {
-			return err
+// Err returns the error, if any, that ended the iteration of the rows. The
+// errors returned by Scan are not reported by Err.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// RowIndex returns the index of the current row, counting from zero, or -1
+// before the first row.
+func (d *Decoder) RowIndex() int {
+	return d.row - 1
+}
+
+// Close closes the rows when they have a Close method, as *sql.Rows does.
+func (d *Decoder) Close() error {
+	if c, ok := d.rows.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// AutoClose causes the Decoder to close the rows when Decode or Scan returns
+// an error, including io.EOF once the rows are exhausted, and when Next
+// returns false.
+// DecodeResultSets closes the rows once it has decoded every result set
+// instead of when each result set is exhausted.
+func (d *Decoder) AutoClose() {
+	d.autoClose = true
+}
+
+// SetNameMapper sets the NameMapper that determines how column names are
+// matched to the names of struct fields. The default is ExactNames.
+func (d *Decoder) SetNameMapper(m NameMapper) {
+	d.d.opts.names = m
+	d.d.plan = nil
+}
+
+// SetTagParser sets the TagParser that parses the tags of struct fields. The
+// default is SQLTags.
+func (d *Decoder) SetTagParser(p TagParser) {
+	d.d.opts.tags = p
+	d.d.plan = nil
+}
+
+// UseCache causes the Decoder to cache the mapping of struct types in c
+// instead of in the cache shared by all decoders.
+func (d *Decoder) UseCache(c *TypeCache) {
+	d.d.cache = c
+	d.d.plan = nil
+}
+
+// SetTagKey causes the Decoder to parse the tags with the given key, which
+// have the same format as sql tags. It is equivalent to
+// SetTagParser(TagKey(key)).
+func (d *Decoder) SetTagKey(key string) {
+	d.SetTagParser(TagKey(key))
+}
+
+// ZeroNulls causes the Decoder to store the zero value when a NULL column is
+// decoded into a value that cannot represent NULL, such as a string or int64,
+// instead of returning an error. A field can opt in individually with the
+// nullzero tag option, as in `sql:"nickname,nullzero"`.
+func (d *Decoder) ZeroNulls() {
+	d.d.nullZero = true
+	d.d.plan = nil
+}
+
+// DisallowUnknownColumns causes the Decoder to return an error when a column
+// has no destination instead of discarding the column.
+func (d *Decoder) DisallowUnknownColumns() {
+	d.d.disallowUnknownColumns = true
+	d.d.plan = nil
+}
+
+// RequireAllFields causes the Decoder to return an error when a field has no
+// column in the result set, as if every field were tagged with the required
+// option. For a ColumnMapper, every column in its ColumnMap is required. A
+// ColumnIndexer must also be a ColumnMapper, whose ColumnMap determines the
+// required columns, or an error is returned.
+func (d *Decoder) RequireAllFields() {
+	d.d.requireAllFields = true
+	d.d.plan = nil
+}
+
+// BytesAsStrings causes the Decoder to store []byte column values as strings
+// when decoding into a map whose elements are interface{} values.
+func (d *Decoder) BytesAsStrings() {
+	d.d.bytesAsStrings = true
+}
+
+// DecodeAll decodes the remaining rows and appends them to the slice pointed to
+// by v. The elements of the slice may be any type that Decode accepts a pointer
+// to, or pointers to such types. Pointer elements to scalar types are nil for
+// NULL columns. DecodeAll returns the first error encountered other than
+// io.EOF, unless CollectRowErrors was called. The errors of rows skipped
+// before an error that stops DecodeAll are joined to the error.
+func (d *Decoder) DecodeAll(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return &UnmarshalTypeError{Type: reflect.TypeOf(v)}
+	}
+
+	sv := rv.Elem()
+	et := sv.Type().Elem()
+	st := et
+	if et.Kind() == reflect.Ptr && !isScalar(et.Elem()) {
+		st = et.Elem()
+	}
+
+	var rowErrs RowErrors
+	for d.Next() {
+		ev := reflect.New(st)
+		fields, setters, err := d.d.fields(ev.Interface())
+		if err == nil {
+			err = d.d.scan(d.RowIndex(), fields, setters)
+			if err != nil && d.collectRowErrors {
+				rowErrs = append(rowErrs, d.rowError(err))
+				if d.maxRowErrors > 0 && len(rowErrs) >= d.maxRowErrors {
+					d.close()
+					return rowErrs
+				}
+				continue
+			}
 		}
-	} else {
-		return io.EOF
+		if err != nil {
+			d.close()
+			return joinRowErrors(err, rowErrs)
+		}
+
+		if st == et {
+			ev = ev.Elem()
+		}
+		sv.Set(reflect.Append(sv, ev))
+	}
+
+	if d.err != nil {
+		return joinRowErrors(d.err, rowErrs)
+	}
+	if len(rowErrs) > 0 {
+		return rowErrs
 	}
 	return nil
 }
 
+// joinRowErrors provides err together with the errors of the rows that were
+// skipped before it occurred, so that the caller can tell that rows are
+// missing.
+func joinRowErrors(err error, rowErrs RowErrors) error {
+	if len(rowErrs) == 0 {
+		return err
+	}
+	return errors.Join(err, rowErrs)
+}
+
+// CollectRowErrors causes DecodeAll to skip the rows that cannot be scanned
+// into their destination instead of returning the first error, and to return
+// the errors as RowErrors once the remaining rows have been decoded. DecodeAll
+// gives up once max rows have been skipped, unless max is zero or less.
+func (d *Decoder) CollectRowErrors(max int) {
+	d.collectRowErrors = true
+	d.maxRowErrors = max
+}
+
+// rowError provides a RowError for the current row, whose scan failed with
+// err.
+func (d *Decoder) rowError(err error) *RowError {
+	re := &RowError{Row: d.RowIndex(), Err: err}
+	cols, cerr := d.rows.Columns()
+	if cerr != nil {
+		return re
+	}
+
+	values := make([]interface{}, len(cols))
+	dests := make([]interface{}, len(cols))
+	for i := range values {
+		dests[i] = &values[i]
+	}
+	if d.rows.Scan(dests...) == nil {
+		re.Values = values
+	}
+	return re
+}
+
 // Scanner copies columns into the values pointed at by dest.
 // *sql.Rows implements Scanner.
 type Scanner interface {
@@ -176,15 +746,36 @@ type Rows interface {
 	Next() bool
 }
 
-// Unmarshal gets the data from row and stores it in v.
-func Unmarshal(s Scanner, v interface{}) error {
-	d := decodeState{tm: make(typeMap), s: s}
-	return d.unmarshal(v)
+// resultSetRows is implemented by Rows that have several result sets, as
+// *sql.Rows does. NextResultSet advances to the next result set and reports
+// whether there is one.
+type resultSetRows interface {
+	NextResultSet() bool
+}
+
+// Unmarshal gets the data from row and stores it in the values in v as Decode
+// does.
+func Unmarshal(s Scanner, v ...interface{}) error {
+	d := decodeState{cache: defaultCache, s: s, opts: mapOptions{names: ExactNames, tags: SQLTags}}
+	return d.unmarshal(-1, v...)
 
 }
 
+// DecodeAll decodes all rows and appends them to the slice pointed to by v.
+func DecodeAll(rows Rows, v interface{}) error {
+	return NewDecoder(rows).DecodeAll(v)
+}
+
+// DecodeResultSets decodes the rows of each result set and appends them to
+// the corresponding slice in v.
+func DecodeResultSets(rows Rows, v ...interface{}) error {
+	return NewDecoder(rows).DecodeResultSets(v...)
+}
+
 // ColumnMap maps column names to values into which the named column can be
-// scanned. Values are expected to be pointers.
+// scanned. Values are expected to be pointers. When a column name is repeated
+// in a result set, the nth occurrence of the column is named by the column
+// name followed by #n, as in id#2.
 type ColumnMap map[string]interface{}
 
 // ColumnMapper is the interface implemented by an object that provides a
@@ -193,3 +784,16 @@ type ColumnMap map[string]interface{}
 type ColumnMapper interface {
 	ColumnMap() ColumnMap
 }
+
+// ColumnIndexer is the interface implemented by an object that resolves
+// column names to values by index, so that no ColumnMap has to be allocated
+// for each row. ColumnIndex is called once for each column of a result set
+// with the name of the column, named as in a ColumnMap, and returns the index
+// of its destination or -1 if the column has no destination. ScanDest returns
+// the value into which the column whose destination has index i should be
+// scanned, and is called for each row. A ColumnIndexer is preferred over a
+// ColumnMapper.
+type ColumnIndexer interface {
+	ColumnIndex(name string) int
+	ScanDest(i int) interface{}
+}
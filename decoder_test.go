@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -46,6 +50,63 @@ func (v *columnMappedContainer) ColumnMap() ColumnMap {
 	}
 }
 
+type columnIndexedContainer struct {
+	id          int64
+	amount      float64
+	description string
+}
+
+func (v *columnIndexedContainer) ColumnIndex(name string) int {
+	switch name {
+	case "ID":
+		return 0
+	case "Amount":
+		return 1
+	case "Description":
+		return 2
+	}
+	return -1
+}
+
+func (v *columnIndexedContainer) ScanDest(i int) interface{} {
+	switch i {
+	case 0:
+		return &v.id
+	case 1:
+		return &v.amount
+	default:
+		return &v.description
+	}
+}
+
+// ColumnMap is never used because ColumnIndexer is preferred.
+func (v *columnIndexedContainer) ColumnMap() ColumnMap {
+	return ColumnMap{}
+}
+
+type indexOnlyContainer struct {
+	id int64
+}
+
+func (v *indexOnlyContainer) ColumnIndex(name string) int {
+	if name == "ID" {
+		return 0
+	}
+	return -1
+}
+
+func (v *indexOnlyContainer) ScanDest(i int) interface{} {
+	return &v.id
+}
+
+type requiredIndexedContainer struct {
+	indexOnlyContainer
+}
+
+func (v *requiredIndexedContainer) ColumnMap() ColumnMap {
+	return ColumnMap{"ID": &v.id, "Nickname": new(string)}
+}
+
 type valueContainer struct {
 	ID           int64
 	Amount       float64
@@ -55,6 +116,28 @@ type valueContainer struct {
 	CreationTime time.Time
 }
 
+func TestColumnIndexer(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []columnIndexedContainer
+	if err = DecodeAll(rows, &actual); err != nil {
+		t.Fatalf("DecodeAll failed: %s", err)
+	}
+
+	if len(actual) != 3 {
+		t.Fatalf("got %d rows, expected 3", len(actual))
+	}
+	expected := columnIndexedContainer{id: 2, amount: 2.2, description: "here is my spout"}
+	if actual[1] != expected {
+		t.Errorf("got %+v, expected %+v", actual[1], expected)
+	}
+}
+
 type taggedValueContainer struct {
 	Natural      int64     `sql:"ID"`
 	Amount       float64   `sql:"Amount"`
@@ -73,6 +156,7 @@ func TestColumnMapper(t *testing.T) {
 	}
 
 	target := NewDecoder(rows)
+	target.UseCache(NewTypeCache())
 
 	expected := columnMappedContainer{id: 1, amount: 1.1, isTruth: false, data: []byte("blob"), description: "short and stout", creationTime: time.Date(2009, 11, 10, 23, 00, 00, 0, time.UTC)}
 	actual := new(columnMappedContainer)
@@ -80,7 +164,7 @@ func TestColumnMapper(t *testing.T) {
 		t.Fatalf("Decode failed: %s", err)
 	}
 
-	if len(target.d.tm) != 0 {
+	if target.d.cache.len() != 0 {
 		t.Fatalf("decoder used type map")
 	}
 
@@ -222,12 +306,13 @@ func TestDecodeStructValueProvidesError(t *testing.T) {
 		t.Fatalf("Decode(*actual), got %s", err.Error())
 	}
 
-	if _, ok := err.(unmarshalTypeError); !ok {
-		t.Fatalf("Decode(*actual), got %v, expected unmarshalTypeError", err)
+	var ute *UnmarshalTypeError
+	if !errors.As(err, &ute) {
+		t.Fatalf("Decode(*actual), got %v, expected *UnmarshalTypeError", err)
 	}
 }
 
-func TestDecodeNonStructProvidesError(t *testing.T) {
+func TestDecodeScalarFromMultipleColumnsProvidesError(t *testing.T) {
 	defer testdb.Reset()
 
 	rows, err := stubRows()
@@ -243,54 +328,1252 @@ func TestDecodeNonStructProvidesError(t *testing.T) {
 		t.Fatalf("Decode(vc), got %s", err.Error())
 	}
 
-	if _, ok := err.(unmarshalTypeError); !ok {
-		t.Fatalf("Decode(*actual), got %v, expected unmarshalTypeError", err)
+	if _, ok := err.(columnCountError); !ok {
+		t.Fatalf("Decode(vc), got %v, expected columnCountError", err)
 	}
 }
 
-// rows is a driver.Rows to be used by the testdb driver.
-type rows struct {
-	closed  bool
-	data    [][]driver.Value
-	columns []string
+func TestDecodeScalar(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"count"}, []driver.Value{42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual int64
+	if err = NewDecoder(rows).Decode(&actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual != 42 {
+		t.Errorf("got %v, expected %v", actual, 42)
+	}
 }
 
-func (r *rows) Close() error {
-	if !r.closed {
-		r.closed = true
+func TestDecodeScalarStruct(t *testing.T) {
+	defer testdb.Reset()
+
+	expected := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	rows, err := stubQuery([]string{"CreationTime"}, []driver.Value{expected}, []driver.Value{nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+
+	var actual time.Time
+	if err = target.Decode(&actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual != expected {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+
+	var scanned sql.NullTime
+	if err = target.Decode(&scanned); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if scanned.Valid {
+		t.Errorf("got %v, expected NULL", scanned)
 	}
-	return nil
 }
 
-func (r *rows) Columns() []string {
-	return r.columns
+func TestDecodeNonPointerScalarProvidesError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+
+	var vc int64
+	err = target.Decode(vc)
+	var ute *UnmarshalTypeError
+	if !errors.As(err, &ute) {
+		t.Fatalf("Decode(vc), got %v, expected *UnmarshalTypeError", err)
+	}
 }
 
-func (r *rows) Next(dest []driver.Value) error {
-	if len(r.data) > 0 {
-		copy(dest, r.data[0][0:])
-		r.data = r.data[1:]
-		return nil
+func TestDecodeMap(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+	target.BytesAsStrings()
+
+	var actual map[string]interface{}
+	if err = target.Decode(&actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if len(actual) != 7 {
+		t.Errorf("got %d entries, expected 7", len(actual))
+	}
+
+	if actual["Amount"] != 1.1 {
+		t.Errorf("got %#v, expected %#v", actual["Amount"], 1.1)
+	}
+
+	if actual["Description"] != "short and stout" {
+		t.Errorf("got %#v, expected %#v", actual["Description"], "short and stout")
 	}
-	return io.EOF
 }
 
-type EmptyRowsRecord struct {
+func TestDecodeTypedMap(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"First", "Last"}, []driver.Value{[]byte("Jane"), nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := map[string]sql.NullString{"Middle": {String: "Q", Valid: true}}
+	if err = NewDecoder(rows).Decode(&actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	expected := map[string]sql.NullString{
+		"First":  {String: "Jane", Valid: true},
+		"Middle": {String: "Q", Valid: true},
+		"Last":   {},
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("got %d entries, expected %d", len(actual), len(expected))
+	}
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Errorf("%s: got %v, expected %v", k, actual[k], v)
+		}
+	}
 }
 
-func (rows EmptyRowsRecord) Rows() Rows {
-	return nil
+func TestDecodeAllMaps(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []map[string]string
+	if err = DecodeAll(rows, &actual); err != nil {
+		t.Fatalf("DecodeAll failed: %s", err)
+	}
+
+	if len(actual) != 3 {
+		t.Fatalf("got %d rows, expected 3", len(actual))
+	}
+
+	if actual[2]["Description"] != "hear me shout" {
+		t.Errorf("got '%v', expected '%v'", actual[2]["Description"], "hear me shout")
+	}
 }
 
-func stubRows() (Rows, error) {
+type nullZeroContainer struct {
+	ID       int64
+	Nickname string `sql:"Nickname,nullzero"`
+}
+
+func TestDecodeNullZeroTag(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Nickname"}, []driver.Value{1, nil}, []driver.Value{nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+
+	actual := nullZeroContainer{Nickname: "stale"}
+	if err = target.Decode(&actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual.Nickname != "" {
+		t.Errorf("got '%v', expected ''", actual.Nickname)
+	}
+
+	if err = target.Decode(&actual); err == nil {
+		t.Errorf("Decode(&actual), expected error for NULL ID")
+	}
+}
+
+func TestDecodeZeroNulls(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Amount", "Description", "CreationTime"}, []driver.Value{nil, nil, nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+	target.ZeroNulls()
+
+	actual := &columnMappedContainer{id: 1, amount: 1.1, description: "stale", creationTime: time.Now()}
+	if err = target.Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	expected := columnMappedContainer{}
+	if actual.id != expected.id || actual.amount != expected.amount || actual.description != expected.description || !actual.creationTime.IsZero() {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
+
+func TestDisallowUnknownColumns(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+	target.DisallowUnknownColumns()
+
+	err = target.Decode(new(valueContainer))
+	uce, ok := err.(unknownColumnsError)
+	if !ok {
+		t.Fatalf("Decode, got %v, expected unknownColumnsError", err)
+	}
+
+	if len(uce.columns) != 1 || uce.columns[0] != "IgnoredField" {
+		t.Errorf("got %v, expected %v", uce.columns, []string{"IgnoredField"})
+	}
+}
+
+type requiredContainer struct {
+	ID       int64
+	Nickname string `sql:",required"`
+}
+
+func TestDecodeRequiredField(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewDecoder(rows).Decode(new(requiredContainer))
+	mce, ok := err.(missingColumnsError)
+	if !ok {
+		t.Fatalf("Decode, got %v, expected missingColumnsError", err)
+	}
+
+	if len(mce.fields) != 1 || mce.fields[0] != "Nickname" {
+		t.Errorf("got %v, expected %v", mce.fields, []string{"Nickname"})
+	}
+}
+
+func TestRequireAllFields(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Amount"}, []driver.Value{1, 1.1}, []driver.Value{2, 2.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+	target.RequireAllFields()
+
+	err = target.Decode(new(valueContainer))
+	mce, ok := err.(missingColumnsError)
+	if !ok {
+		t.Fatalf("Decode, got %v, expected missingColumnsError", err)
+	}
+
+	expected := []string{"CreationTime", "Data", "Description", "IsTruth"}
+	if !reflect.DeepEqual(mce.fields, expected) {
+		t.Errorf("got %v, expected %v", mce.fields, expected)
+	}
+
+	err = target.Decode(new(columnMappedContainer))
+	if _, ok := err.(missingColumnsError); !ok {
+		t.Fatalf("Decode, got %v, expected missingColumnsError", err)
+	}
+}
+
+func TestRequireAllFieldsOfColumnIndexer(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID"}, []driver.Value{1}, []driver.Value{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+	target.RequireAllFields()
+
+	err = target.Decode(new(requiredIndexedContainer))
+	mce, ok := err.(missingColumnsError)
+	if !ok {
+		t.Fatalf("Decode, got %v, expected missingColumnsError", err)
+	}
+	if expected := []string{"Nickname"}; !reflect.DeepEqual(mce.fields, expected) {
+		t.Errorf("got %v, expected %v", mce.fields, expected)
+	}
+
+	err = target.Decode(new(indexOnlyContainer))
+	if _, ok := err.(requireIndexerError); !ok {
+		t.Fatalf("Decode, got %v, expected requireIndexerError", err)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []taggedValueContainer
+	if err = NewDecoder(rows).DecodeAll(&actual); err != nil {
+		t.Fatalf("DecodeAll failed: %s", err)
+	}
+
+	if len(actual) != 3 {
+		t.Fatalf("got %d rows, expected 3", len(actual))
+	}
+
+	for i, v := range actual {
+		if v.Natural != int64(i+1) {
+			t.Errorf("got %v, expected %v", v.Natural, i+1)
+		}
+	}
+}
+
+func TestDecodeAllPointers(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := []*columnMappedContainer{}
+	if err = DecodeAll(rows, &actual); err != nil {
+		t.Fatalf("DecodeAll failed: %s", err)
+	}
+
+	if len(actual) != 3 {
+		t.Fatalf("got %d rows, expected 3", len(actual))
+	}
+
+	for i, v := range actual {
+		if v.id != int64(i+1) {
+			t.Errorf("got %v, expected %v", v.id, i+1)
+		}
+	}
+}
+
+func TestDecodeAllNonSliceProvidesError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := new(taggedValueContainer)
+	err = DecodeAll(rows, actual)
+	var ute *UnmarshalTypeError
+	if !errors.As(err, &ute) {
+		t.Fatalf("DecodeAll(actual), got %v, expected *UnmarshalTypeError", err)
+	}
+}
+
+func TestDecodeAllScalars(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID"}, []driver.Value{1}, []driver.Value{2}, []driver.Value{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []int64
+	if err = DecodeAll(rows, &actual); err != nil {
+		t.Fatalf("DecodeAll failed: %s", err)
+	}
+
+	if len(actual) != 3 {
+		t.Fatalf("got %d rows, expected 3", len(actual))
+	}
+
+	for i, v := range actual {
+		if v != int64(i+1) {
+			t.Errorf("got %v, expected %v", v, i+1)
+		}
+	}
+}
+
+func TestDecodeAllScalarPointers(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID"}, []driver.Value{1}, []driver.Value{nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []*int64
+	if err = DecodeAll(rows, &actual); err != nil {
+		t.Fatalf("DecodeAll failed: %s", err)
+	}
+
+	if len(actual) != 2 {
+		t.Fatalf("got %d rows, expected 2", len(actual))
+	}
+	if actual[0] == nil || *actual[0] != 1 {
+		t.Errorf("got %v, expected 1", actual[0])
+	}
+	if actual[1] != nil {
+		t.Errorf("got %v, expected nil", *actual[1])
+	}
+}
+
+func TestDecodeWithoutDestinationsProvidesError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID"}, []driver.Value{1}, []driver.Value{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	if err = d.Decode(); err != errNoDestinations {
+		t.Errorf("Decode(), got %v, expected %v", err, errNoDestinations)
+	}
+
+	var id int64
+	if err = d.Decode(&id); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if id != 1 {
+		t.Errorf("got %v, expected 1", id)
+	}
+
+	if !d.Next() {
+		t.Fatalf("Next failed: %v", d.Err())
+	}
+	if err = d.Scan(); err != errNoDestinations {
+		t.Errorf("Scan(), got %v, expected %v", err, errNoDestinations)
+	}
+	if err = Unmarshal(rows); err != errNoDestinations {
+		t.Errorf("Unmarshal(rows), got %v, expected %v", err, errNoDestinations)
+	}
+}
+
+func TestDecodeMultipleDestinations(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Name", "ID", "Total", "Extra"},
+		[]driver.Value{1, []byte("Ada"), 7, 9.5, []byte("extra")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type user struct {
+		ID   int64
+		Name string
+	}
+	type order struct {
+		ID    int64
+		Total float64
+	}
+
+	var u user
+	var o order
+	var rest map[string]interface{}
+	if err = NewDecoder(rows).Decode(&u, &o, &rest); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if u.ID != 1 || u.Name != "Ada" {
+		t.Errorf("got user %+v, expected {ID:1 Name:Ada}", u)
+	}
+	// the first ID column is claimed by user, so order is decoded from the second.
+	if o.ID != 7 || o.Total != 9.5 {
+		t.Errorf("got order %+v, expected {ID:7 Total:9.5}", o)
+	}
+	if len(rest) != 1 || string(rest["Extra"].([]byte)) != "extra" {
+		t.Errorf("got rest %v, expected only Extra", rest)
+	}
+}
+
+func TestDecodePrefixedDestinations(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"user_ID", "user_Name", "order_ID", "order_Total"},
+		[]driver.Value{1, []byte("Ada"), 7, 9.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type user struct {
+		ID   int64
+		Name string
+	}
+	type order struct {
+		ID    int64
+		Total float64
+	}
+
+	var u user
+	var o order
+	d := NewDecoder(rows)
+	d.DisallowUnknownColumns()
+	if err = d.Decode(Prefix("order_", &o), Prefix("user_", &u)); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if u.ID != 1 || u.Name != "Ada" {
+		t.Errorf("got user %+v, expected {ID:1 Name:Ada}", u)
+	}
+	if o.ID != 7 || o.Total != 9.5 {
+		t.Errorf("got order %+v, expected {ID:7 Total:9.5}", o)
+	}
+}
+
+func TestDecodeMultipleScalars(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Name"}, []driver.Value{1, []byte("Ada")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id int64
+	var name string
+	if err = NewDecoder(rows).Decode(&id, &name); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if id != 1 || name != "Ada" {
+		t.Errorf("got %d and %q, expected 1 and \"Ada\"", id, name)
+	}
+}
+
+type benchmarkRecord struct {
+	ID          int64
+	Amount      float64
+	IsTruth     bool
+	Description string
+	Ignored     string `sql:"-"`
+}
+
+// stubBenchmarkRows stubs a query that returns n rows of a benchmarkRecord
+// and a column without a destination.
+func stubBenchmarkRows(b *testing.B, n int) Rows {
+	data := make([][]driver.Value, n)
+	for i := range data {
+		data[i] = []driver.Value{int64(i), 1.1, true, "short and stout", "unmapped"}
+	}
+	rows, err := stubQuery([]string{"ID", "Amount", "IsTruth", "Description", "Unmapped"}, data...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return rows
+}
+
+func BenchmarkDecodeStruct(b *testing.B) {
+	defer testdb.Reset()
+
+	d := NewDecoder(stubBenchmarkRows(b, b.N))
+	var v benchmarkRecord
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeAll(b *testing.B) {
+	defer testdb.Reset()
+
+	rows := stubBenchmarkRows(b, b.N)
+	var v []benchmarkRecord
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := DecodeAll(rows, &v); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkDecodeColumnMapper(b *testing.B) {
+	defer testdb.Reset()
+
+	d := NewDecoder(stubBenchmarkRows(b, b.N))
+	var v columnMappedContainer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeColumnIndexer(b *testing.B) {
+	defer testdb.Reset()
+
+	d := NewDecoder(stubBenchmarkRows(b, b.N))
+	var v columnIndexedContainer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeMap(b *testing.B) {
+	defer testdb.Reset()
+
+	d := NewDecoder(stubBenchmarkRows(b, b.N))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v map[string]interface{}
+		if err := d.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeScalar(b *testing.B) {
+	defer testdb.Reset()
+
+	data := make([][]driver.Value, b.N)
+	for i := range data {
+		data[i] = []driver.Value{int64(i)}
+	}
+	rows, err := stubQuery([]string{"ID"}, data...)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	var v int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "amount"}, []driver.Value{1, 1.5}, []driver.Value{2, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Order struct {
+		ID    int64
+		Total float64 `sql:"amount"`
+	}
+
+	d := NewDecoder(rows)
+	var v Order
+	if err = d.Decode(&v); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	err = d.Decode(&v)
+
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %v, expected *FieldError", err)
+	}
+	if fe.Column != "amount" || fe.ColumnIndex != 1 || fe.Field != "Order.Total" || fe.Type != reflect.TypeOf(float64(0)) || fe.Row != 1 {
+		t.Errorf("got %+v, expected column amount at index 1, field Order.Total of type float64 and row 1", *fe)
+	}
+	if fe.Err == nil || strings.HasPrefix(fe.Err.Error(), "sql:") {
+		t.Errorf("got cause %v, expected the cause without the sql package's context", fe.Err)
+	}
+	if expected := "row 1, column amount → Order.Total: "; !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("got %q, expected it to begin with %q", err, expected)
+	}
+}
+
+func TestFieldErrorFromUnmarshal(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID"}, []driver.Value{nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Next()
+
+	var id int64
+	err = Unmarshal(rows, &id)
+
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %v, expected *FieldError", err)
+	}
+	if fe.Row != -1 || fe.Field != "" || fe.Type != reflect.TypeOf(id) {
+		t.Errorf("got %+v, expected row -1 and type int64 without a field", *fe)
+	}
+	if expected := "column ID → int64: "; !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("got %q, expected it to begin with %q", err, expected)
+	}
+}
+
+func TestFieldErrorWithZeroNulls(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Amount"}, []driver.Value{1, []byte("many")}, []driver.Value{2, []byte("many")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	d.ZeroNulls()
+	for _, v := range []interface{}{new(columnMappedContainer), new(map[string]float64)} {
+		err = d.Decode(v)
+
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			t.Fatalf("got %v, expected *FieldError", err)
+		}
+		if fe.Field != "" || fe.Type != reflect.TypeOf(float64(0)) {
+			t.Errorf("%T: got %+v, expected type float64 without a field", v, *fe)
+		}
+	}
+}
+
+// errCode is returned by code.Scan for a value that is not a code.
+var errCode = errors.New("invalid code")
+
+// code is a sql.Scanner whose errors wrap errCode.
+type code string
+
+func (c *code) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok || len(b) != 3 {
+		return fmt.Errorf("scanning %v: %w", src, errCode)
+	}
+	*c = code(b)
+	return nil
+}
+
+func TestFieldErrorKeepsScanError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"code"}, []driver.Value{[]byte("ABCD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c code
+	err = NewDecoder(rows).Decode(&c)
+
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %v, expected *FieldError", err)
+	}
+	if expected := "scanning [65 66 67 68]: invalid code"; fe.Err == nil || fe.Err.Error() != expected {
+		t.Errorf("got cause %v, expected %q", fe.Err, expected)
+	}
+
+	scanErr := fmt.Errorf("decoding ID: %w", io.ErrUnexpectedEOF)
+	var id int64
+	err = NewDecoder(&failingRows{n: 1, scanErr: scanErr, badRow: 0}).Decode(&id)
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %v, expected *FieldError", err)
+	}
+	if fe.Err != scanErr {
+		t.Errorf("got cause %v, expected %v", fe.Err, scanErr)
+	}
+}
+
+// stubMessyRows stubs a query whose second and fourth rows have a NULL amount.
+func stubMessyRows() (Rows, error) {
+	return stubQuery([]string{"ID", "amount"},
+		[]driver.Value{1, 1.5},
+		[]driver.Value{2, nil},
+		[]driver.Value{3, 3.5},
+		[]driver.Value{4, nil},
+		[]driver.Value{5, 5.5})
+}
+
+type messyOrder struct {
+	ID    int64
+	Total float64 `sql:"amount"`
+}
+
+func TestCollectRowErrors(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMessyRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	d.CollectRowErrors(0)
+	var orders []messyOrder
+	err = d.DecodeAll(&orders)
+
+	var rowErrs RowErrors
+	if !errors.As(err, &rowErrs) {
+		t.Fatalf("got %v, expected RowErrors", err)
+	}
+	if len(orders) != 3 || orders[2].ID != 5 {
+		t.Errorf("got %+v, expected the orders with IDs 1, 3 and 5", orders)
+	}
+	if len(rowErrs) != 2 || rowErrs[0].Row != 1 || rowErrs[1].Row != 3 {
+		t.Fatalf("got %v, expected errors for rows 1 and 3", rowErrs)
+	}
+	if values := rowErrs[0].Values; len(values) != 2 || values[1] != nil {
+		t.Errorf("got values %v, expected [2 <nil>]", values)
+	}
+
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != "messyOrder.Total" {
+		t.Errorf("got %v, expected a *FieldError for messyOrder.Total", fe)
+	}
+	if expected := "Cannot decode 2 rows: row 1, column amount → messyOrder.Total: "; !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("got %q, expected it to begin with %q", err, expected)
+	}
+}
+
+func TestRowErrorsWithoutRows(t *testing.T) {
+	if actual, expected := RowErrors(nil).Error(), "No rows were skipped"; actual != expected {
+		t.Errorf("got %q, expected %q", actual, expected)
+	}
+}
+
+func TestCollectRowErrorsGivesUp(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMessyRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	d.CollectRowErrors(2)
+	var orders []messyOrder
+	err = d.DecodeAll(&orders)
+
+	var rowErrs RowErrors
+	if !errors.As(err, &rowErrs) || len(rowErrs) != 2 {
+		t.Fatalf("got %v, expected RowErrors for 2 rows", err)
+	}
+	if len(orders) != 2 {
+		t.Errorf("got %d orders, expected decoding to stop at the second error", len(orders))
+	}
+}
+
+func TestCollectRowErrorsWithRowsErr(t *testing.T) {
+	rowsErr := errors.New("connection reset")
+	scanErr := errors.New("bad row")
+	d := NewDecoder(&failingRows{n: 3, err: rowsErr, scanErr: scanErr, badRow: 1})
+	d.CollectRowErrors(0)
+
+	var ids []int64
+	err := d.DecodeAll(&ids)
+	if !errors.Is(err, rowsErr) {
+		t.Errorf("got %v, expected it to include %v", err, rowsErr)
+	}
+	var rowErrs RowErrors
+	if !errors.As(err, &rowErrs) || len(rowErrs) != 1 || rowErrs[0].Row != 1 {
+		t.Errorf("got %v, expected it to include the error of row 1", err)
+	}
+	if !errors.Is(err, scanErr) {
+		t.Errorf("got %v, expected it to include %v", err, scanErr)
+	}
+	if len(ids) != 2 {
+		t.Errorf("got %d rows, expected 2", len(ids))
+	}
+}
+
+func TestDecodeAllStopsAtRowError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMessyRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var orders []messyOrder
+	err = DecodeAll(rows, &orders)
+
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Row != 1 {
+		t.Fatalf("got %v, expected a *FieldError for row 1", err)
+	}
+	if len(orders) != 1 {
+		t.Errorf("got %d orders, expected 1", len(orders))
+	}
+}
+
+// failingRows is a Rows whose iteration ends with err after n rows.
+type failingRows struct {
+	n      int
+	err    error
+	closed bool
+
+	// scanErr is returned by Scan for the row after which badRow rows
+	// remain, when it is not nil.
+	scanErr error
+	badRow  int
+}
+
+func (r *failingRows) Columns() ([]string, error) {
+	return []string{"ID"}, nil
+}
+
+func (r *failingRows) Scan(dest ...interface{}) error {
+	if r.scanErr != nil && r.n == r.badRow {
+		return r.scanErr
+	}
+	*dest[0].(*int64) = int64(r.n)
+	return nil
+}
+
+func (r *failingRows) Next() bool {
+	if r.closed || r.n == 0 {
+		return false
+	}
+	r.n--
+	return true
+}
+
+func (r *failingRows) Err() error {
+	return r.err
+}
+
+func (r *failingRows) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestDecodeReturnsRowsErr(t *testing.T) {
+	expected := errors.New("connection reset")
+	rows := &failingRows{n: 1, err: expected}
+	d := NewDecoder(rows)
+
+	var id int64
+	if err := d.Decode(&id); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if err := d.Decode(&id); err != expected {
+		t.Errorf("got %v, expected %v", err, expected)
+	}
+
+	var ids []int64
+	if err := DecodeAll(&failingRows{n: 2, err: expected}, &ids); err != expected {
+		t.Errorf("got %v from DecodeAll, expected %v", err, expected)
+	}
+}
+
+func TestAutoClose(t *testing.T) {
+	rows := &failingRows{n: 1}
+	d := NewDecoder(rows)
+	d.AutoClose()
+
+	var id int64
+	if err := d.Decode(&id); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if rows.closed {
+		t.Fatalf("rows were closed before they were exhausted")
+	}
+	if err := d.Decode(&id); err != io.EOF {
+		t.Fatalf("got %v, expected io.EOF", err)
+	}
+	if !rows.closed {
+		t.Errorf("rows were not closed once they were exhausted")
+	}
+
+	rows = &failingRows{n: 1}
+	d = NewDecoder(rows)
+	d.AutoClose()
+	var s struct{ Missing int64 }
+	d.RequireAllFields()
+	if err := d.Decode(&s); err == nil {
+		t.Fatalf("expected an error for the missing column")
+	}
+	if !rows.closed {
+		t.Errorf("rows were not closed after an error")
+	}
+
+	rows = &failingRows{n: 2}
+	d = NewDecoder(rows)
+	d.AutoClose()
+	d.RequireAllFields()
+	if !d.Next() {
+		t.Fatalf("Next returned false, expected a row")
+	}
+	if err := d.Scan(&s); err == nil {
+		t.Fatalf("expected an error for the missing column")
+	}
+	if !rows.closed {
+		t.Errorf("rows were not closed after an error from Scan")
+	}
+}
+
+func TestDecoderClose(t *testing.T) {
+	rows := &failingRows{n: 2}
+	d := NewDecoder(rows)
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	if !rows.closed {
+		t.Errorf("rows were not closed")
+	}
+
+	var id int64
+	if err := d.Decode(&id); err != io.EOF {
+		t.Errorf("got %v, expected io.EOF after Close", err)
+	}
+
+	if err := NewDecoder(nil).Close(); err != nil {
+		t.Errorf("got %v closing a Decoder without rows, expected nil", err)
+	}
+}
+
+func TestNextScan(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	if i := d.RowIndex(); i != -1 {
+		t.Errorf("got row index %d before the first row, expected -1", i)
+	}
+
+	var ids []int64
+	for d.Next() {
+		var v valueContainer
+		if err := d.Scan(&v); err != nil {
+			t.Fatalf("Scan failed: %s", err)
+		}
+		if i := d.RowIndex(); i != len(ids) {
+			t.Errorf("got row index %d, expected %d", i, len(ids))
+		}
+		ids = append(ids, v.ID)
+	}
+	if err := d.Err(); err != nil {
+		t.Fatalf("Err returned %s", err)
+	}
+
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Errorf("got %v, expected [1 2 3]", ids)
+	}
+}
+
+func TestNextErr(t *testing.T) {
+	expected := errors.New("connection reset")
+	d := NewDecoder(&failingRows{n: 2, err: expected})
+
+	n := 0
+	for d.Next() {
+		var id int64
+		if err := d.Scan(&id); err != nil {
+			t.Fatalf("Scan failed: %s", err)
+		}
+		n++
+	}
+
+	if n != 2 {
+		t.Errorf("got %d rows, expected 2", n)
+	}
+	if err := d.Err(); err != expected {
+		t.Errorf("got %v, expected %v", err, expected)
+	}
+}
+
+// resultSets is a Rows with several result sets, each of which has a single
+// ID column.
+type resultSets struct {
+	sets   [][]int64
+	row    int
+	closed bool
+}
+
+func (r *resultSets) Columns() ([]string, error) {
+	return []string{"ID"}, nil
+}
+
+func (r *resultSets) Scan(dest ...interface{}) error {
+	*dest[0].(*int64) = r.sets[0][r.row-1]
+	return nil
+}
+
+func (r *resultSets) Next() bool {
+	if r.closed || len(r.sets) == 0 || r.row == len(r.sets[0]) {
+		return false
+	}
+	r.row++
+	return true
+}
+
+func (r *resultSets) NextResultSet() bool {
+	if r.closed || len(r.sets) < 2 {
+		return false
+	}
+	r.sets, r.row = r.sets[1:], 0
+	return true
+}
+
+func (r *resultSets) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestDecodeResultSets(t *testing.T) {
+	rows := &resultSets{sets: [][]int64{{1, 2}, {3}, {4, 5, 6}}}
+
+	var headers []int64
+	var lines []int64
+	var totals []int64
+	d := NewDecoder(rows)
+	d.AutoClose()
+	if err := d.DecodeResultSets(&headers, &lines, &totals); err != nil {
+		t.Fatalf("DecodeResultSets failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(headers, []int64{1, 2}) {
+		t.Errorf("got headers %v, expected [1 2]", headers)
+	}
+	if !reflect.DeepEqual(lines, []int64{3}) {
+		t.Errorf("got lines %v, expected [3]", lines)
+	}
+	if !reflect.DeepEqual(totals, []int64{4, 5, 6}) {
+		t.Errorf("got totals %v, expected [4 5 6]", totals)
+	}
+	if !rows.closed {
+		t.Errorf("rows were not closed after the result sets were decoded")
+	}
+}
+
+func TestAutoCloseResultSetRows(t *testing.T) {
+	rows := &resultSets{sets: [][]int64{{1}, {2}}}
+	d := NewDecoder(rows)
+	d.AutoClose()
+
+	var id int64
+	if err := d.Decode(&id); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if err := d.Decode(&id); err != io.EOF {
+		t.Fatalf("got %v, expected io.EOF", err)
+	}
+	if !rows.closed {
+		t.Errorf("rows were not closed once the result set was exhausted")
+	}
+}
+
+func TestDecodeResultSetsTooFew(t *testing.T) {
+	var first, second []int64
+	err := DecodeResultSets(&resultSets{sets: [][]int64{{1}}}, &first, &second)
+	if err == nil {
+		t.Fatalf("expected an error for the missing result set")
+	}
+	if expected := "Cannot decode 1 result sets into 2 destinations"; err.Error() != expected {
+		t.Errorf("got %q, expected %q", err, expected)
+	}
+}
+
+func TestNextResultSetResetsPlan(t *testing.T) {
+	rows := &resultSets{sets: [][]int64{{1}, {2}}}
+	d := NewDecoder(rows)
+
+	var id int64
+	if err := d.Decode(&id); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if !d.NextResultSet() {
+		t.Fatalf("NextResultSet returned false")
+	}
+	if d.d.plan != nil {
+		t.Errorf("plan was not reset")
+	}
+	if i := d.RowIndex(); i != -1 {
+		t.Errorf("got row index %d, expected -1", i)
+	}
+	if err := d.Decode(&id); err != nil || id != 2 {
+		t.Errorf("got %d and %v, expected 2 and nil", id, err)
+	}
+}
+
+// rows is a driver.Rows to be used by the testdb driver.
+type rows struct {
+	closed  bool
+	data    [][]driver.Value
+	columns []string
+}
+
+func (r *rows) Close() error {
+	if !r.closed {
+		r.closed = true
+	}
+	return nil
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.data) > 0 {
+		copy(dest, r.data[0][0:])
+		r.data = r.data[1:]
+		return nil
+	}
+	return io.EOF
+}
+
+type EmptyRowsRecord struct {
+}
+
+func (rows EmptyRowsRecord) Rows() Rows {
+	return nil
+}
+
+func stubRows() (Rows, error) {
+	return stubQuery([]string{"ID", "Amount", "IsTruth", "Data", "Description", "CreationTime", "IgnoredField"},
+		[]driver.Value{1, 1.1, false, []byte("I am a little teapot"), []byte("short and stout"), time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC), []byte("ignored")})
+}
+
+func stubMultipleRows() (Rows, error) {
+	return stubQuery([]string{"ID", "Amount", "IsTruth", "Data", "Description", "CreationTime", "IgnoredField"},
+		[]driver.Value{1, 1.1, false, []byte("I am a little teapot"), []byte("short and stout"), time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC), []byte("ignored")},
+		[]driver.Value{2, 2.2, true, []byte("here is my handle"), []byte("here is my spout"), time.Date(2009, 11, 11, 23, 0, 0, 0, time.UTC), []byte("ignored")},
+		[]driver.Value{3, 3.3, false, []byte("when I get all steamed up"), []byte("hear me shout"), time.Date(2009, 11, 12, 23, 0, 0, 0, time.UTC), []byte("ignored")})
+}
+
+// stubQuery stubs a query that returns columns and data and provides its rows.
+func stubQuery(columns []string, data ...[]driver.Value) (Rows, error) {
 	db, err := sql.Open("testdb", "")
 	if err != nil {
 		return nil, err
 	}
 
 	sql := "SELECT fields FROM TheTable"
-	result := &rows{columns: []string{"ID", "Amount", "IsTruth", "Data", "Description", "CreationTime", "IgnoredField"},
-		data: [][]driver.Value{[]driver.Value{1, 1.1, false, []byte("I am a little teapot"), []byte("short and stout"), time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC), []byte("ignored")}}}
+	result := &rows{columns: columns, data: data}
 	testdb.StubQuery(sql, result)
 
 	return db.Query(sql)
@@ -0,0 +1,592 @@
+package sqldecoder
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// structMap is the mapping of a struct type's columns to its fields.
+type structMap struct {
+	fields map[string]field
+
+	// all holds every field, sorted by path.
+	all []field
+
+	// defaults holds the fields that have a default value.
+	defaults []field
+
+	// required holds the fields that are tagged with the required option,
+	// sorted by path.
+	required []field
+
+	// rest is the field tagged with the rest option. It is nil when no
+	// field has the option.
+	rest *field
+}
+
+// mapOptions determines how the fields of a struct are mapped to columns.
+type mapOptions struct {
+	names NameMapper
+	tags  TagParser
+}
+
+type tagError struct {
+	rt    reflect.Type
+	field string
+	err   error
+}
+
+func (e tagError) Error() string {
+	return "Invalid tag on field " + e.field + " of type " + e.rt.String() + ": " + e.err.Error()
+}
+
+type fieldConflictError struct {
+	rt     reflect.Type
+	column string
+	fields []string
+}
+
+func (e fieldConflictError) Error() string {
+	return "Cannot map column " + e.column + " to more than one field of type " + e.rt.String() + ": " + strings.Join(e.fields, ", ")
+}
+
+// field is a struct field to which a column can be mapped.
+type field struct {
+	// name is the key by which the field is matched to a column.
+	name   string
+	index  []int
+	typ    reflect.Type
+	tagged bool
+
+	// path is the Go selector of the field relative to the struct being
+	// mapped, such as Billing.Street.
+	path string
+
+	// optional holds the depths within index of the optional pointers to
+	// structs that enclose the field, outermost first.
+	optional []int
+
+	// nullZero causes the zero value to be stored when the column is NULL.
+	nullZero bool
+
+	// required causes an error when the field has no column.
+	required bool
+
+	// rest is true when the field receives the columns that are not mapped
+	// to other fields.
+	rest bool
+
+	// def is the value stored when the column is NULL or is not in the
+	// result set. It is the zero Value when the field has no default.
+	def reflect.Value
+}
+
+// newStructMap provides the structMap for the struct type t. The keys of its
+// fields are column names, as provided by the Column method of opts.names. The
+// column name for a given exported field is (in priority order):
+//
+//	the name in the field's tag, as parsed by opts.tags
+//	the field name as mapped by the Field method of opts.names
+//
+// The fields of embedded structs are promoted following Go's rules: a field
+// at a shallower depth shadows deeper fields of the same name, a tagged field
+// shadows untagged fields at the same depth, and otherwise ambiguous fields
+// are not mapped at all. An error is returned when fields with different
+// names at the same depth are mapped to the same column.
+//
+// The fields of a struct field whose tag has a prefix option, as in
+// `sql:",prefix=billing_"`, are mapped to the columns named by the prefix
+// followed by the column name of the nested field. When such a field is a
+// pointer, it is optional: it is left nil if all of the columns mapped to its
+// fields are NULL. Otherwise its fields are decoded like any other, so a NULL
+// column is an error unless its field can store NULL, has a default or
+// decodes NULL as its zero value.
+//
+// A default option, as in `sql:"status,default=active"`, provides the value
+// of a field when its column is NULL or is not in the result set. An error is
+// returned when a default cannot be parsed as a value of the field's type.
+//
+// When a column name is repeated in a result set, as when columns of joined
+// tables have the same name, the nth occurrence of the column is mapped to
+// the field tagged with the name followed by #n, as in `sql:"id#2"`.
+//
+// A field tagged with the rest option, as in `sql:",rest"`, receives the
+// columns that are not mapped to any other field. It is expected to be a map
+// whose keys are strings, and at most one field may have the option.
+func newStructMap(t reflect.Type, opts mapOptions) (*structMap, error) {
+	fields, err := structFields(t, opts, fieldScope{}, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	sm := &structMap{fields: make(map[string]field)}
+	named := fields[:0:0]
+	for _, f := range fields {
+		if !f.rest {
+			named = append(named, f)
+			continue
+		}
+		if sm.rest != nil {
+			return nil, tagError{rt: t, field: f.path, err: errors.New("option rest is repeated by field " + sm.rest.path)}
+		}
+		if f.typ.Kind() != reflect.Map || f.typ.Key().Kind() != reflect.String {
+			return nil, tagError{rt: t, field: f.path, err: errors.New("option rest requires a map with string keys")}
+		}
+		rest := f
+		sm.rest = &rest
+	}
+
+	sort.SliceStable(named, func(i, j int) bool {
+		if named[i].name != named[j].name {
+			return named[i].name < named[j].name
+		}
+		return len(named[i].index) < len(named[j].index)
+	})
+
+	for i := 0; i < len(named); {
+		j := i + 1
+		for j < len(named) && named[j].name == named[i].name {
+			j++
+		}
+		f, ok, err := dominantField(t, named[i:j])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			sm.fields[f.name] = f
+			sm.all = append(sm.all, f)
+		}
+		i = j
+	}
+	sort.Slice(sm.all, func(i, j int) bool { return sm.all[i].path < sm.all[j].path })
+
+	for _, f := range sm.all {
+		if f.def.IsValid() {
+			sm.defaults = append(sm.defaults, f)
+		}
+		if f.required {
+			sm.required = append(sm.required, f)
+		}
+	}
+	return sm, nil
+}
+
+// fieldScope describes where the fields of a struct are within the struct
+// being mapped.
+type fieldScope struct {
+	// index is the index path of the struct.
+	index []int
+
+	// path is the Go selector of the struct.
+	path string
+
+	// prefix is prepended to the column names of the struct's fields.
+	prefix string
+
+	// optional holds the depths of the optional pointers that enclose the
+	// struct.
+	optional []int
+}
+
+// structFields provides the fields of t, including the promoted fields of
+// embedded structs and the fields of prefixed structs. scope describes where
+// t is within the struct being mapped, opts determines how the fields are
+// mapped, and visited holds the types that enclose t.
+func structFields(t reflect.Type, opts mapOptions, scope fieldScope, visited map[reflect.Type]bool) ([]field, error) {
+	visited[t] = true
+	defer delete(visited, t)
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fi := make([]int, len(scope.index)+1)
+		copy(fi, scope.index)
+		fi[len(scope.index)] = i
+		path := sf.Name
+		if scope.path != "" {
+			path = scope.path + "." + sf.Name
+		}
+
+		tg, err := opts.tags.ParseTag(sf.Tag)
+		if err == nil {
+			err = tg.validate()
+		}
+		if err != nil {
+			return nil, tagError{rt: t, field: sf.Name, err: err}
+		}
+		if tg.Ignore {
+			continue
+		}
+
+		fieldPrefix, prefixed := tg.Options["prefix"]
+		if (sf.Anonymous && tg.Name == "") || prefixed {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isScalar(ft) {
+				if !visited[ft] && (sf.PkgPath == "" || sf.Anonymous) {
+					nested := fieldScope{index: fi, path: path, prefix: scope.prefix + fieldPrefix, optional: scope.optional}
+					if prefixed && !sf.Anonymous && sf.Type.Kind() == reflect.Ptr {
+						nested.optional = append(scope.optional[:len(scope.optional):len(scope.optional)], len(fi))
+					}
+					nestedFields, err := structFields(ft, opts, nested, visited)
+					if err != nil {
+						return nil, err
+					}
+					fields = append(fields, nestedFields...)
+				}
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		_, nullZero := tg.Options["nullzero"]
+		_, required := tg.Options["required"]
+		_, rest := tg.Options["rest"]
+		f := field{name: opts.names.Column(scope.prefix + opts.names.Field(sf.Name)), index: fi, typ: sf.Type, path: path, optional: scope.optional, nullZero: nullZero, required: required, rest: rest}
+		if tg.Name != "" {
+			name, occurrence := splitOccurrence(tg.Name)
+			f.name = opts.names.Column(scope.prefix+name) + occurrence
+			f.tagged = true
+		}
+		if def, ok := tg.Options["default"]; ok {
+			v, err := parseDefault(sf.Type, def)
+			if err != nil {
+				return nil, tagError{rt: t, field: sf.Name, err: err}
+			}
+			f.def = v
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// splitOccurrence splits a column name such as id#2, which names the second
+// occurrence of the column id, into the name and the occurrence suffix. The
+// suffix of the first occurrence is empty.
+func splitOccurrence(name string) (string, string) {
+	i := strings.LastIndex(name, "#")
+	if i == -1 {
+		return name, ""
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 1 {
+		return name, ""
+	}
+	if n == 1 {
+		return name[:i], ""
+	}
+	return name[:i], "#" + strconv.Itoa(n)
+}
+
+// parseDefault parses s as a value of type t, which is expected to be a
+// string, boolean, integer, floating point number, time.Duration, time.Time in
+// RFC 3339 format, or a pointer to one of those.
+func parseDefault(t reflect.Type, s string) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		ev, err := parseDefault(t.Elem(), s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.New(t.Elem())
+		v.Elem().Set(ev)
+		return v, nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch {
+	case t == timeType:
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Set(reflect.ValueOf(tm))
+		return v, nil
+	case t == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetFloat(n)
+	default:
+		return reflect.Value{}, fmt.Errorf("default values of type %s are not supported", t)
+	}
+	return v, nil
+}
+
+// defaultValue provides the default value of f. A pointer default is copied so
+// that values do not share it.
+func (f field) defaultValue() reflect.Value {
+	if f.def.Kind() != reflect.Ptr {
+		return f.def
+	}
+	v := reflect.New(f.typ.Elem())
+	v.Elem().Set(f.def.Elem())
+	return v
+}
+
+// setDefaults stores the default value of each of fields in dst. Optional
+// pointers to structs are not allocated to store a default.
+func setDefaults(dst reflect.Value, fields []field) {
+	for _, f := range fields {
+		var fv reflect.Value
+		if len(f.optional) > 0 {
+			fv = existingField(dst, f.index)
+		} else {
+			fv = fieldByIndex(dst, f.index)
+		}
+		if fv.IsValid() && fv.CanSet() {
+			fv.Set(f.defaultValue())
+		}
+	}
+}
+
+// dominantField provides the field of t that is mapped from among fields,
+// which all have the same name and are sorted by depth. No field is mapped
+// when fields with the same Go name are ambiguous, and an error is returned
+// when fields with different Go names conflict.
+func dominantField(t reflect.Type, fields []field) (field, bool, error) {
+	depth := len(fields[0].index)
+	var dominant []field
+	for _, f := range fields {
+		if len(f.index) > depth {
+			break
+		}
+		dominant = append(dominant, f)
+	}
+	if len(dominant) == 1 {
+		return dominant[0], true, nil
+	}
+
+	var tagged []field
+	for _, f := range dominant {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true, nil
+	}
+	if len(tagged) > 1 {
+		dominant = tagged
+	}
+
+	paths := make([]string, len(dominant))
+	ambiguous := true
+	for i, f := range dominant {
+		paths[i] = f.path
+		ambiguous = ambiguous && f.goName() == dominant[0].goName()
+	}
+	if ambiguous {
+		return field{}, false, nil
+	}
+	return field{}, false, fieldConflictError{rt: t, column: dominant[0].name, fields: paths}
+}
+
+// goName provides the name of f's struct field.
+func (f field) goName() string {
+	return f.path[strings.LastIndex(f.path, ".")+1:]
+}
+
+// fieldByIndex provides the field of v at index, allocating nil pointers to
+// embedded structs along the way. The zero Value is returned when a nil
+// pointer cannot be allocated.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// nullableValue is a temporary into which the column mapped to a field is
+// scanned when the field is within an optional pointer to a struct or when
+// NULL is to be decoded as the field's zero value.
+type nullableValue struct {
+	f   field
+	col int           // the index of the column
+	tmp reflect.Value // a **T; *tmp is nil when the column is NULL
+
+	// groups holds the indexes of the optional pointers that enclose the
+	// field, outermost first, and zero reports whether NULL is stored as the
+	// zero value of the field when they are allocated.
+	groups []int
+	zero   bool
+}
+
+// An optionalGroup is an optional pointer to a struct and the indexes of the
+// nullable values of the columns mapped to its fields.
+type optionalGroup struct {
+	index  []int
+	values []int
+}
+
+// nullColumnError reports that the NULL column at index col could not be
+// stored in a field within an optional pointer to a struct.
+type nullColumnError struct {
+	col int
+	typ reflect.Type
+}
+
+func (e nullColumnError) Error() string {
+	return "converting NULL to " + e.typ.String() + " is unsupported"
+}
+
+// setNullable stores the scanned values of fields in dst. A NULL column is
+// stored as the default or zero value of its field. An optional pointer in
+// groups is allocated if any column mapped to its fields is not NULL and is
+// otherwise set to nil. present is set to whether each of groups is
+// allocated. A nullColumnError is returned when a NULL column is mapped to a
+// field within an allocated pointer that has no default and cannot store
+// NULL.
+func setNullable(dst reflect.Value, values []nullableValue, groups []optionalGroup, present []bool) error {
+	for g, group := range groups {
+		present[g] = false
+		for _, n := range group.values {
+			if !values[n].tmp.Elem().IsNil() {
+				present[g] = true
+				break
+			}
+		}
+	}
+
+	for _, v := range values {
+		if !v.tmp.Elem().IsNil() {
+			fieldByIndex(dst, v.f.index).Set(v.tmp.Elem().Elem())
+			continue
+		}
+
+		absent := false
+		for _, g := range v.groups {
+			if !present[g] {
+				if pv := existingField(dst, groups[g].index); pv.IsValid() {
+					pv.Set(reflect.Zero(pv.Type()))
+				}
+				absent = true
+				break
+			}
+		}
+		if absent {
+			continue
+		}
+
+		fv := fieldByIndex(dst, v.f.index)
+		switch {
+		case v.f.def.IsValid():
+			fv.Set(v.f.defaultValue())
+		case v.zero:
+			fv.Set(reflect.Zero(fv.Type()))
+		default:
+			return nullColumnError{col: v.col, typ: v.f.typ}
+		}
+	}
+	return nil
+}
+
+// existingField provides the field of v at index without allocating nil
+// pointers. The zero Value is returned when the path includes a nil pointer.
+func existingField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// acceptsNull reports whether a NULL column can be scanned into a value of
+// type t.
+func acceptsNull(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice:
+		return true
+	}
+	return reflect.PtrTo(t).Implements(scannerType)
+}
+
+// nullZero provides a temporary into which a column can be scanned in place of
+// dest, which is expected to be a pointer, and a setter that stores the scanned
+// value in dest, or the zero value when the column is NULL. dest is provided
+// without a setter when NULL can be scanned into it.
+func nullZero(dest interface{}) (interface{}, func() error) {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || acceptsNull(dv.Type().Elem()) {
+		return dest, nil
+	}
+
+	tmp := reflect.New(dv.Type())
+	return tmp.Interface(), func() error {
+		if tmp.Elem().IsNil() {
+			dv.Elem().Set(reflect.Zero(dv.Type().Elem()))
+		} else {
+			dv.Elem().Set(tmp.Elem().Elem())
+		}
+		return nil
+	}
+}
+
+// isScalar reports whether a value of type t is scanned from a single column
+// instead of having its fields mapped to columns.
+func isScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PtrTo(t).Implements(scannerType) {
+		return true
+	}
+	return t.Kind() != reflect.Struct && t.Kind() != reflect.Map
+}
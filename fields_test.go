@@ -0,0 +1,445 @@
+package sqldecoder
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/erikstmartin/go-testdb"
+)
+
+type Base struct {
+	ID int64
+}
+
+type Audit struct {
+	CreationTime time.Time
+	Description  string
+}
+
+type embeddedContainer struct {
+	Base
+	*Audit
+	Amount float64
+}
+
+type shadowedContainer struct {
+	Base
+	Audit
+	ID          int64  `sql:"Natural"`
+	Description string `sql:"Description"`
+}
+
+type ambiguousContainer struct {
+	Base
+	Other struct{ ID int64 }
+	*otherBase
+}
+
+type otherBase struct {
+	ID int64
+}
+
+// fieldIndexes provides the index path of each field mapped from typ.
+func fieldIndexes(t *testing.T, typ reflect.Type) map[string][]int {
+	sm, err := newStructMap(typ, mapOptions{names: ExactNames, tags: SQLTags})
+	if err != nil {
+		t.Fatalf("newStructMap failed: %s", err)
+	}
+
+	indexes := make(map[string][]int, len(sm.fields))
+	for name, f := range sm.fields {
+		indexes[name] = f.index
+	}
+	return indexes
+}
+
+func TestStructMapEmbedded(t *testing.T) {
+	actual := fieldIndexes(t, reflect.TypeOf(embeddedContainer{}))
+	expected := map[string][]int{
+		"ID":           {0, 0},
+		"CreationTime": {1, 0},
+		"Description":  {1, 1},
+		"Amount":       {2},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
+
+func TestStructMapShadowed(t *testing.T) {
+	actual := fieldIndexes(t, reflect.TypeOf(shadowedContainer{}))
+	expected := map[string][]int{
+		"ID":           {0, 0},
+		"CreationTime": {1, 0},
+		"Natural":      {2},
+		"Description":  {3},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
+
+func TestStructMapAmbiguous(t *testing.T) {
+	actual := fieldIndexes(t, reflect.TypeOf(ambiguousContainer{}))
+	expected := map[string][]int{
+		"Other": {1},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
+
+func TestDecodeEmbedded(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := new(embeddedContainer)
+	if err = NewDecoder(rows).Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual.ID != 1 {
+		t.Errorf("got %v, expected %v", actual.ID, 1)
+	}
+
+	if actual.Audit == nil {
+		t.Fatalf("embedded pointer was not allocated")
+	}
+
+	if actual.Description != "short and stout" {
+		t.Errorf("got '%v', expected '%v'", actual.Description, "short and stout")
+	}
+}
+
+func TestDecodeEmbeddedPointerNotAllocated(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Amount"}, []driver.Value{1, 1.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := new(embeddedContainer)
+	if err = NewDecoder(rows).Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual.Audit != nil {
+		t.Errorf("got %v, expected nil", actual.Audit)
+	}
+}
+
+type Address struct {
+	Street string
+	City   string `sql:"town"`
+}
+
+type prefixedContainer struct {
+	ID       int64
+	Billing  Address  `sql:",prefix=billing_"`
+	Shipping *Address `sql:",prefix=shipping_"`
+	Home     struct {
+		Address `sql:",prefix=addr_"`
+	} `sql:",prefix=home_"`
+}
+
+func TestStructMapPrefixed(t *testing.T) {
+	actual := fieldIndexes(t, reflect.TypeOf(prefixedContainer{}))
+	expected := map[string][]int{
+		"ID":               {0},
+		"billing_Street":   {1, 0},
+		"billing_town":     {1, 1},
+		"shipping_Street":  {2, 0},
+		"shipping_town":    {2, 1},
+		"home_addr_Street": {3, 0, 0},
+		"home_addr_town":   {3, 0, 1},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
+
+func TestDecodePrefixed(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "billing_Street", "billing_town", "shipping_Street", "shipping_town"},
+		[]driver.Value{1, []byte("1 Main St"), []byte("Springfield"), []byte("2 Elm St"), []byte("Shelbyville")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := new(prefixedContainer)
+	if err = NewDecoder(rows).Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	expected := Address{Street: "1 Main St", City: "Springfield"}
+	if actual.Billing != expected {
+		t.Errorf("got %v, expected %v", actual.Billing, expected)
+	}
+
+	expected = Address{Street: "2 Elm St", City: "Shelbyville"}
+	if actual.Shipping == nil || *actual.Shipping != expected {
+		t.Errorf("got %v, expected %v", actual.Shipping, expected)
+	}
+}
+
+type Employee struct {
+	ID   int64
+	Name string
+}
+
+type department struct {
+	Name    string
+	Manager *Employee `sql:",prefix=manager_"`
+}
+
+func TestDecodeOptional(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"Name", "manager_ID", "manager_Name"},
+		[]driver.Value{[]byte("Sales"), 7, []byte("Ann")},
+		[]driver.Value{[]byte("Research"), nil, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+
+	actual := new(department)
+	if err = target.Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	expected := Employee{ID: 7, Name: "Ann"}
+	if actual.Manager == nil || *actual.Manager != expected {
+		t.Errorf("got %v, expected %v", actual.Manager, expected)
+	}
+
+	if err = target.Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual.Name != "Research" {
+		t.Errorf("got '%v', expected '%v'", actual.Name, "Research")
+	}
+
+	if actual.Manager != nil {
+		t.Errorf("got %v, expected nil", actual.Manager)
+	}
+}
+
+func TestDecodeOptionalNullField(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Name"}, []driver.Value{7, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewDecoder(rows).Decode(new(Employee))
+	if expected == nil {
+		t.Fatal("Decode succeeded, expected an error")
+	}
+
+	rows, err = stubQuery([]string{"Name", "manager_ID", "manager_Name"}, []driver.Value{[]byte("Sales"), 7, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewDecoder(rows).Decode(new(department))
+
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %v, expected a *FieldError", err)
+	}
+	if fe.Column != "manager_Name" || fe.ColumnIndex != 2 || fe.Field != "department.Manager.Name" {
+		t.Errorf("got %+v, expected the error of manager_Name", fe)
+	}
+	if fe.Err.Error() != errors.Unwrap(expected).Error() {
+		t.Errorf("got %v, expected %v", fe.Err, errors.Unwrap(expected))
+	}
+}
+
+type defaultsContainer struct {
+	ID      int64
+	Status  string        `sql:"status,default=active"`
+	Retries *int          `sql:"retries,default=3"`
+	Timeout time.Duration `sql:"timeout,default=1m30s"`
+	Since   time.Time     `sql:"since,default=2009-11-10T23:00:00Z"`
+}
+
+func TestDecodeDefaults(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "status", "retries"},
+		[]driver.Value{1, nil, nil},
+		[]driver.Value{2, []byte("retired"), 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []defaultsContainer
+	if err = DecodeAll(rows, &actual); err != nil {
+		t.Fatalf("DecodeAll failed: %s", err)
+	}
+
+	if actual[0].Status != "active" {
+		t.Errorf("got '%v', expected '%v'", actual[0].Status, "active")
+	}
+
+	if actual[0].Retries == nil || *actual[0].Retries != 3 {
+		t.Errorf("got %v, expected %v", actual[0].Retries, 3)
+	}
+
+	if actual[0].Timeout != 90*time.Second {
+		t.Errorf("got %v, expected %v", actual[0].Timeout, 90*time.Second)
+	}
+
+	if expected := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC); !actual[0].Since.Equal(expected) {
+		t.Errorf("got %v, expected %v", actual[0].Since, expected)
+	}
+
+	if actual[1].Status != "retired" {
+		t.Errorf("got '%v', expected '%v'", actual[1].Status, "retired")
+	}
+
+	if actual[1].Retries == nil || *actual[1].Retries != 5 {
+		t.Errorf("got %v, expected %v", actual[1].Retries, 5)
+	}
+
+	if actual[0].Retries == actual[1].Retries {
+		t.Errorf("default pointer was shared")
+	}
+}
+
+func TestInvalidDefaultProvidesError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := &struct {
+		ID int64 `sql:"ID,default=one"`
+	}{}
+	err = NewDecoder(rows).Decode(actual)
+	if _, ok := err.(tagError); !ok {
+		t.Fatalf("Decode(actual), got %v, expected tagError", err)
+	}
+}
+
+type restContainer struct {
+	ID    int64
+	Extra map[string]string `sql:",rest"`
+}
+
+func TestDecodeRest(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "color", "size"}, []driver.Value{1, []byte("red"), 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+	target.DisallowUnknownColumns()
+
+	actual := new(restContainer)
+	if err = target.Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	expected := map[string]string{"color": "red", "size": "10"}
+	if !reflect.DeepEqual(actual.Extra, expected) {
+		t.Errorf("got %v, expected %v", actual.Extra, expected)
+	}
+}
+
+func TestInvalidRestProvidesError(t *testing.T) {
+	tests := []interface{}{
+		struct {
+			Extra []string `sql:",rest"`
+		}{},
+		struct {
+			Extra map[string]string      `sql:",rest"`
+			More  map[string]interface{} `sql:",rest"`
+		}{},
+	}
+
+	for _, tt := range tests {
+		_, err := newStructMap(reflect.TypeOf(tt), mapOptions{names: ExactNames, tags: SQLTags})
+		if _, ok := err.(tagError); !ok {
+			t.Errorf("newStructMap(%T), got %v, expected tagError", tt, err)
+		}
+	}
+}
+
+type duplicateColumnsContainer struct {
+	ID      int64
+	OtherID int64 `sql:"ID#2"`
+	Name    string
+}
+
+func TestDecodeDuplicateColumns(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Name", "ID", "Name"},
+		[]driver.Value{1, []byte("order"), 2, []byte("customer")},
+		[]driver.Value{3, []byte("order"), 4, []byte("customer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+
+	actual := new(duplicateColumnsContainer)
+	if err = target.Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	expected := duplicateColumnsContainer{ID: 1, OtherID: 2, Name: "order"}
+	if *actual != expected {
+		t.Errorf("got %v, expected %v", *actual, expected)
+	}
+
+	target.DisallowUnknownColumns()
+	err = target.Decode(actual)
+	uce, ok := err.(unknownColumnsError)
+	if !ok {
+		t.Fatalf("Decode, got %v, expected unknownColumnsError", err)
+	}
+
+	if len(uce.columns) != 1 || uce.columns[0] != "Name#2" {
+		t.Errorf("got %v, expected %v", uce.columns, []string{"Name#2"})
+	}
+}
+
+func TestDecodeDuplicateColumnsIntoMap(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "ID"}, []driver.Value{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual map[string]int64
+	if err = NewDecoder(rows).Decode(&actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	expected := map[string]int64{"ID": 1, "ID#2": 2}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %v, expected %v", actual, expected)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/bhcleek/sqldecoder
 
+go 1.23
+
 require github.com/erikstmartin/go-testdb v0.0.0-20160219214506-8d10e4a1bae5
@@ -0,0 +1,99 @@
+package sqldecoder
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A NameMapper determines how column names are matched to the names of struct
+// fields. A column is mapped to a field when the keys provided for each are
+// equal. Tags take precedence over the names of untagged fields.
+// The mapping of struct types is only cached for implementations that are
+// comparable.
+type NameMapper interface {
+	// Field provides the column name for an untagged struct field.
+	Field(name string) string
+
+	// Column provides the key by which a column name is matched. It is
+	// also applied to the column names provided by Field and by tags.
+	Column(name string) string
+}
+
+type nameMapper struct {
+	field  func(string) string
+	column func(string) string
+}
+
+func (m *nameMapper) Field(name string) string {
+	return m.field(name)
+}
+
+func (m *nameMapper) Column(name string) string {
+	return m.column(name)
+}
+
+func identity(s string) string {
+	return s
+}
+
+var (
+	// ExactNames maps fields to the columns that have exactly the same
+	// name. It is the default NameMapper.
+	ExactNames NameMapper = &nameMapper{field: identity, column: identity}
+
+	// CaseInsensitiveNames maps fields to the columns whose names differ
+	// from the field name only in case.
+	CaseInsensitiveNames NameMapper = &nameMapper{field: strings.ToLower, column: strings.ToLower}
+
+	// SnakeCaseNames maps fields to the columns named by the snake_case form
+	// of the field name, so that a field named CreationTime is mapped to the
+	// column creation_time. Column names are matched case-insensitively so
+	// that upper-case column names such as CREATION_TIME are also mapped.
+	SnakeCaseNames NameMapper = &nameMapper{field: snakeCase, column: strings.ToLower}
+
+	// LowerCaseNames maps fields to the columns named by the lower-case form
+	// of the field name.
+	LowerCaseNames NameMapper = &nameMapper{field: strings.ToLower, column: identity}
+
+	// UpperCaseNames maps fields to the columns named by the upper-case form
+	// of the field name.
+	UpperCaseNames NameMapper = &nameMapper{field: strings.ToUpper, column: identity}
+)
+
+// NameMapperFunc returns a NameMapper that maps fields to the columns named by
+// f. Column names are matched exactly. Functions cannot be compared, so the
+// mapping of struct types is not cached for the NameMapper.
+func NameMapperFunc(f func(string) string) NameMapper {
+	return funcNameMapper(f)
+}
+
+type funcNameMapper func(string) string
+
+func (f funcNameMapper) Field(name string) string {
+	return f(name)
+}
+
+func (f funcNameMapper) Column(name string) string {
+	return name
+}
+
+// snakeCase provides the snake_case form of s. Runs of upper-case letters are
+// treated as a single word, so that UserID becomes user_id and HTTPServer
+// becomes http_server.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' {
+				prev := runes[i-1]
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+					b.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package sqldecoder
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/erikstmartin/go-testdb"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"ID":           "id",
+		"UserID":       "user_id",
+		"CreationTime": "creation_time",
+		"HTTPServer":   "http_server",
+		"Address2":     "address2",
+		"Line2Text":    "line2_text",
+		"already_done": "already_done",
+		"Mixed_Case":   "mixed_case",
+	}
+
+	for name, expected := range tests {
+		if actual := snakeCase(name); actual != expected {
+			t.Errorf("snakeCase(%q), got %q, expected %q", name, actual, expected)
+		}
+	}
+}
+
+type snakeCaseContainer struct {
+	UserID       int64
+	CreationTime string
+	Description  string `sql:"Description"`
+}
+
+func TestDecodeNameMappers(t *testing.T) {
+	tests := []struct {
+		mapper  NameMapper
+		columns []string
+	}{
+		{mapper: SnakeCaseNames, columns: []string{"user_id", "creation_time", "description"}},
+		{mapper: SnakeCaseNames, columns: []string{"USER_ID", "CREATION_TIME", "DESCRIPTION"}},
+		{mapper: CaseInsensitiveNames, columns: []string{"USERID", "creationtime", "DeScRiPtIoN"}},
+		{mapper: LowerCaseNames, columns: []string{"userid", "creationtime", "Description"}},
+		{mapper: UpperCaseNames, columns: []string{"USERID", "CREATIONTIME", "Description"}},
+		{mapper: NameMapperFunc(func(s string) string { return "x_" + s }), columns: []string{"x_UserID", "x_CreationTime", "Description"}},
+	}
+
+	expected := snakeCaseContainer{UserID: 1, CreationTime: "now", Description: "short and stout"}
+	for _, tt := range tests {
+		rows, err := stubQuery(tt.columns, []driver.Value{1, []byte("now"), []byte("short and stout")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		target := NewDecoder(rows)
+		target.SetNameMapper(tt.mapper)
+
+		var actual snakeCaseContainer
+		if err = target.Decode(&actual); err != nil {
+			t.Errorf("Decode with columns %v failed: %s", tt.columns, err)
+		} else if actual != expected {
+			t.Errorf("columns %v: got %v, expected %v", tt.columns, actual, expected)
+		}
+		testdb.Reset()
+	}
+}
+
+type collidingContainer struct {
+	UserID int64
+	UserId int64
+}
+
+func TestNameMapperCollisionProvidesError(t *testing.T) {
+	_, err := newStructMap(reflect.TypeOf(collidingContainer{}), mapOptions{names: SnakeCaseNames, tags: SQLTags})
+	if _, ok := err.(fieldConflictError); !ok {
+		t.Fatalf("newStructMap, got %v, expected fieldConflictError", err)
+	}
+
+	if _, err = newStructMap(reflect.TypeOf(collidingContainer{}), mapOptions{names: ExactNames, tags: SQLTags}); err != nil {
+		t.Errorf("newStructMap failed: %s", err)
+	}
+}
+
+func TestDecodeColumnsMappedToSameName(t *testing.T) {
+	type user struct {
+		ID int64
+	}
+
+	for _, disallow := range []bool{false, true} {
+		rows, err := stubQuery([]string{"ID", "id"}, []driver.Value{1, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		target := NewDecoder(rows)
+		target.SetNameMapper(CaseInsensitiveNames)
+		if disallow {
+			target.DisallowUnknownColumns()
+		}
+
+		var actual user
+		err = target.Decode(&actual)
+		if disallow {
+			if _, ok := err.(unknownColumnsError); !ok {
+				t.Errorf("Decode(&actual), got %v, expected unknownColumnsError", err)
+			}
+		} else if err != nil {
+			t.Errorf("Decode failed: %s", err)
+		} else if actual.ID != 1 {
+			t.Errorf("got %v, expected 1", actual.ID)
+		}
+		testdb.Reset()
+	}
+}
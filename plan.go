@@ -0,0 +1,488 @@
+package sqldecoder
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A plan records how the columns of a result set are decoded into
+// destinations of particular types, so that the columns only have to be
+// mapped to struct fields for the first row. The scan destinations and the
+// sinks for columns without a destination are reused for each row.
+type plan struct {
+	cols    []string
+	dests   []destPlan
+	fields  []interface{}
+	setters []func() error
+
+	// targets describes the destination into which each column is
+	// decoded, which may differ from the value into which it is scanned.
+	// The target of a column decoded into a scalar, a ColumnMapper or a
+	// ColumnIndexer is only recorded while the column is scanned into a
+	// temporary, and the target of a column without a destination is the
+	// zero target.
+	targets []target
+}
+
+// A target is a destination into which a column is decoded.
+type target struct {
+	// path is the Go selector of a struct field, qualified by the name of
+	// the struct type, as in Order.Total. It is empty when the destination
+	// is not a struct field.
+	path string
+	typ  reflect.Type
+}
+
+// destKind identifies how a destination is decoded.
+type destKind int
+
+const (
+	indexerDest destKind = iota
+	mapperDest
+	scalarDest
+	mapDest
+	structDest
+)
+
+// A destPlan records how the columns claimed by a destination are decoded.
+type destPlan struct {
+	typ    reflect.Type
+	prefix string
+	kind   destKind
+
+	// cols holds the indexes of the columns claimed by the destination and
+	// keys holds their keys.
+	cols []int
+	keys []string
+
+	// indexes holds the index provided by a ColumnIndexer for each claimed
+	// column.
+	indexes []int
+
+	// fields holds the field of a struct destination to which each claimed
+	// column is mapped, or the zero field for a column stored in the rest
+	// field. temps holds the temporary for each column that is scanned into
+	// one instead of into its field, and nullable holds those temporaries
+	// with their fields.
+	fields   []field
+	temps    []reflect.Value
+	nullable []nullableValue
+
+	// optional holds the optional pointers to structs that enclose the
+	// fields in nullable, and present records for each row whether each of
+	// them is allocated.
+	optional []optionalGroup
+	present  []bool
+
+	// absent holds the fields with default values that have no column.
+	absent []field
+
+	rest *field
+}
+
+// claim records that the column at index i, whose key is key, is decoded into
+// the destination.
+func (dp *destPlan) claim(i int, key string) {
+	dp.cols = append(dp.cols, i)
+	dp.keys = append(dp.keys, key)
+}
+
+// target provides the target of the jth column claimed by a struct
+// destination.
+func (dp *destPlan) target(j int) target {
+	t := dp.typ.Elem()
+	name := t.Name()
+	if name == "" {
+		name = t.String()
+	}
+	if f := dp.fields[j]; f.index != nil {
+		return target{path: name + "." + f.path, typ: f.typ}
+	}
+	return target{path: name + "." + dp.rest.path + "[" + strconv.Quote(dp.keys[j]) + "]", typ: dp.rest.typ.Elem()}
+}
+
+// matches reports whether p was compiled for the columns cols and for
+// destinations of the same types as v.
+func (p *plan) matches(cols []string, v []interface{}) bool {
+	if p == nil || len(cols) != len(p.cols) || len(v) != len(p.dests) {
+		return false
+	}
+	for i, col := range cols {
+		if col != p.cols[i] {
+			return false
+		}
+	}
+	for n, dest := range v {
+		prefix := ""
+		if pf, ok := dest.(*prefixed); ok {
+			prefix, dest = pf.prefix, pf.v
+		}
+		if p.dests[n].prefix != prefix || p.dests[n].typ != reflect.TypeOf(dest) {
+			return false
+		}
+	}
+	return true
+}
+
+// compile provides the plan for decoding the columns cols into v.
+func (ds *decodeState) compile(cols []string, v []interface{}) (*plan, error) {
+	if len(v) == 1 && len(cols) != 1 {
+		switch v[0].(type) {
+		case ColumnIndexer, ColumnMapper:
+		default:
+			if rt := reflect.TypeOf(v[0]); rt != nil && rt.Kind() == reflect.Ptr && isScalar(rt.Elem()) {
+				return nil, columnCountError{rt: rt.Elem(), n: len(cols)}
+			}
+		}
+	}
+
+	p := &plan{
+		cols:    append([]string(nil), cols...),
+		dests:   make([]destPlan, len(v)),
+		fields:  make([]interface{}, len(cols)),
+		targets: make([]target, len(cols)),
+	}
+	claimed := make([]bool, len(cols))
+	for n, dest := range v {
+		dp := &p.dests[n]
+		if pf, ok := dest.(*prefixed); ok {
+			dp.prefix, dest = pf.prefix, pf.v
+		}
+		dp.typ = reflect.TypeOf(dest)
+
+		offered := make([]int, 0, len(cols))
+		names := make([]string, 0, len(cols))
+		for i, col := range cols {
+			if !claimed[i] && strings.HasPrefix(col, dp.prefix) {
+				offered = append(offered, i)
+				names = append(names, col[len(dp.prefix):])
+			}
+		}
+
+		if err := ds.compileDest(dp, dest, offered, names, columnKeys(names)); err != nil {
+			return nil, err
+		}
+		for j, i := range dp.cols {
+			claimed[i] = true
+			switch dp.kind {
+			case structDest:
+				p.targets[i] = dp.target(j)
+			case mapDest:
+				p.targets[i] = target{typ: dp.typ.Elem().Elem()}
+			}
+		}
+	}
+
+	var unknown []string
+	for i, key := range columnKeys(cols) {
+		if !claimed[i] {
+			p.fields[i] = new(interface{})
+			unknown = append(unknown, key)
+		}
+	}
+	if ds.disallowUnknownColumns && len(unknown) > 0 {
+		return nil, unknownColumnsError{columns: unknown}
+	}
+	return p, nil
+}
+
+// compileDest records in dp how the columns offered to the destination v are
+// decoded. offered holds the indexes of the offered columns, names holds
+// their names without the destination's prefix, and keys holds their keys.
+func (ds *decodeState) compileDest(dp *destPlan, v interface{}, offered []int, names, keys []string) error {
+	if ci, ok := v.(ColumnIndexer); ok {
+		dp.kind = indexerDest
+		if ds.requireAllFields {
+			m, ok := v.(ColumnMapper)
+			if !ok {
+				return requireIndexerError{rt: dp.typ}
+			}
+			if err := requireColumns(dp.typ, m.ColumnMap(), keys); err != nil {
+				return err
+			}
+		}
+		for j, key := range keys {
+			if x := ci.ColumnIndex(key); x >= 0 {
+				dp.claim(offered[j], key)
+				dp.indexes = append(dp.indexes, x)
+			}
+		}
+		return nil
+	}
+
+	if m, ok := v.(ColumnMapper); ok {
+		dp.kind = mapperDest
+		cm := m.ColumnMap()
+		if ds.requireAllFields {
+			if err := requireColumns(dp.typ, cm, keys); err != nil {
+				return err
+			}
+		}
+		for j, key := range keys {
+			if _, ok := cm[key]; ok {
+				dp.claim(offered[j], key)
+			}
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &UnmarshalTypeError{Type: dp.typ}
+	}
+
+	switch t := dp.typ.Elem(); {
+	case isScalar(t):
+		dp.kind = scalarDest
+		if len(keys) > 0 {
+			dp.claim(offered[0], keys[0])
+		}
+
+	case t.Kind() == reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return &UnmarshalTypeError{Type: t}
+		}
+		dp.kind = mapDest
+		for j, key := range keys {
+			dp.claim(offered[j], key)
+		}
+
+	case t.Kind() == reflect.Struct:
+		dp.kind = structDest
+		return ds.compileStruct(dp, t, offered, names, keys)
+
+	default:
+		return &UnmarshalTypeError{Type: t}
+	}
+	return nil
+}
+
+// compileStruct records in dp how the columns offered to a struct of type t
+// are decoded. The column name for a given exported field is (in priority
+// order):
+//
+//	the name in the field's tag, as parsed by the decoder's TagParser
+//	the field name as mapped by the decoder's NameMapper
+//
+// Columns mapped to fields within optional pointers to structs, and to fields
+// that decode NULL as their default or zero value, are scanned into
+// temporaries. The default values of fields whose columns are not in the
+// result set are recorded, and the columns that are not mapped to a field are
+// claimed for the field tagged with the rest option. An error is returned
+// when a required field has no column.
+func (ds *decodeState) compileStruct(dp *destPlan, t reflect.Type, offered []int, names, keys []string) error {
+	sm, err := ds.cache.structMap(t, ds.opts)
+	if err != nil {
+		return err
+	}
+
+	// The occurrences of repeated columns are counted after the names are
+	// mapped, so that columns whose names only differ before mapping are
+	// not decoded into the same field.
+	columns := make([]string, len(names))
+	for j, name := range names {
+		columns[j] = ds.opts.names.Column(name)
+	}
+
+	mapped := make(map[string]bool, len(names))
+	var unmapped []int
+	for j, key := range columnKeys(columns) {
+		f, ok := sm.fields[key]
+		if !ok {
+			unmapped = append(unmapped, j)
+			continue
+		}
+		mapped[f.name] = true
+
+		var tmp reflect.Value
+		nullZero := (f.nullZero || ds.nullZero) && !acceptsNull(f.typ)
+		if len(f.optional) > 0 || f.def.IsValid() || nullZero {
+			tmp = reflect.New(reflect.PtrTo(f.typ))
+			zero := nullZero || acceptsNull(f.typ)
+			dp.nullable = append(dp.nullable, nullableValue{f: f, col: offered[j], tmp: tmp, zero: zero})
+		}
+		dp.claim(offered[j], keys[j])
+		dp.fields = append(dp.fields, f)
+		dp.temps = append(dp.temps, tmp)
+	}
+
+	dp.groupOptional()
+
+	if sm.rest != nil {
+		dp.rest = sm.rest
+		for _, j := range unmapped {
+			dp.claim(offered[j], keys[j])
+			dp.fields = append(dp.fields, field{})
+			dp.temps = append(dp.temps, reflect.Value{})
+		}
+	}
+
+	required := sm.required
+	if ds.requireAllFields {
+		required = sm.all
+	}
+	var missing []string
+	for _, f := range required {
+		if !mapped[f.name] {
+			missing = append(missing, f.path)
+		}
+	}
+	if len(missing) > 0 {
+		return missingColumnsError{rt: t, fields: missing}
+	}
+
+	for _, f := range sm.defaults {
+		if !mapped[f.name] {
+			dp.absent = append(dp.absent, f)
+		}
+	}
+	return nil
+}
+
+// groupOptional records in dp the optional pointers to structs that enclose
+// the fields of its nullable values.
+func (dp *destPlan) groupOptional() {
+	groups := make(map[string]int)
+	for n := range dp.nullable {
+		v := &dp.nullable[n]
+		for _, d := range v.f.optional {
+			key := fmt.Sprint(v.f.index[:d])
+			g, ok := groups[key]
+			if !ok {
+				g = len(dp.optional)
+				groups[key] = g
+				dp.optional = append(dp.optional, optionalGroup{index: v.f.index[:d]})
+			}
+			dp.optional[g].values = append(dp.optional[g].values, n)
+			v.groups = append(v.groups, g)
+		}
+	}
+	dp.present = make([]bool, len(dp.optional))
+}
+
+// bind provides the destinations into which the columns of the current row
+// should be scanned for the values in v, which have the types p was compiled
+// for, and the setters to call once the row has been scanned.
+func (ds *decodeState) bind(p *plan, v []interface{}) ([]interface{}, []func() error, error) {
+	p.setters = p.setters[:0]
+	for n, dest := range v {
+		if pf, ok := dest.(*prefixed); ok {
+			dest = pf.v
+		}
+		dp := &p.dests[n]
+
+		switch dp.kind {
+		case indexerDest:
+			ci := dest.(ColumnIndexer)
+			for j, i := range dp.cols {
+				p.fields[i] = ds.scanDest(p, i, ci.ScanDest(dp.indexes[j]))
+			}
+			continue
+
+		case mapperDest:
+			cm := dest.(ColumnMapper).ColumnMap()
+			for j, i := range dp.cols {
+				fd, ok := cm[dp.keys[j]]
+				if !ok {
+					fd = new(interface{})
+				}
+				p.fields[i] = ds.scanDest(p, i, fd)
+			}
+			continue
+		}
+
+		rv := reflect.ValueOf(dest)
+		if rv.IsNil() {
+			return nil, nil, &UnmarshalTypeError{Type: dp.typ}
+		}
+
+		switch dp.kind {
+		case scalarDest:
+			for _, i := range dp.cols {
+				p.fields[i] = ds.scanDest(p, i, dest)
+			}
+
+		case mapDest:
+			m := rv.Elem()
+			if m.IsNil() {
+				m.Set(reflect.MakeMap(m.Type()))
+			}
+			for j, i := range dp.cols {
+				tmp, set := ds.mapEntry(m, dp.keys[j])
+				p.fields[i] = tmp
+				p.setters = append(p.setters, set)
+			}
+
+		case structDest:
+			ds.bindStruct(p, dp, rv.Elem())
+		}
+	}
+	return p.fields, p.setters, nil
+}
+
+// scanDest provides the value into which the column at index i should be
+// scanned in place of fd, and adds the setter that stores the scanned value in
+// fd to the setters of p when NULL is to be decoded as the zero value of fd.
+// The type of fd is then recorded as the target of the column.
+func (ds *decodeState) scanDest(p *plan, i int, fd interface{}) interface{} {
+	if !ds.nullZero {
+		return fd
+	}
+	tmp, set := nullZero(fd)
+	if set != nil {
+		p.setters = append(p.setters, set)
+		p.targets[i].typ = reflect.TypeOf(fd).Elem()
+	} else {
+		p.targets[i].typ = nil
+	}
+	return tmp
+}
+
+// bindStruct provides the destinations of the columns claimed by the struct
+// dst and the setters that store its temporaries and default values.
+func (ds *decodeState) bindStruct(p *plan, dp *destPlan, dst reflect.Value) {
+	var rest reflect.Value
+	if dp.rest != nil {
+		if rest = fieldByIndex(dst, dp.rest.index); rest.IsValid() && rest.CanSet() {
+			if rest.IsNil() {
+				rest.Set(reflect.MakeMap(rest.Type()))
+			}
+		} else {
+			rest = reflect.Value{}
+		}
+	}
+
+	for j, i := range dp.cols {
+		switch f := &dp.fields[j]; {
+		case dp.temps[j].IsValid():
+			p.fields[i] = dp.temps[j].Interface()
+		case f.index == nil:
+			if rest.IsValid() {
+				tmp, set := ds.mapEntry(rest, dp.keys[j])
+				p.fields[i] = tmp
+				p.setters = append(p.setters, set)
+			} else {
+				p.fields[i] = new(interface{})
+			}
+		default:
+			if fv := fieldByIndex(dst, f.index); fv.IsValid() && fv.CanSet() {
+				p.fields[i] = fv.Addr().Interface()
+			} else {
+				p.fields[i] = new(interface{})
+			}
+		}
+	}
+
+	if nullable := dp.nullable; len(nullable) > 0 {
+		optional, present := dp.optional, dp.present
+		p.setters = append(p.setters, func() error { return setNullable(dst, nullable, optional, present) })
+	}
+	if absent := dp.absent; len(absent) > 0 {
+		p.setters = append(p.setters, func() error {
+			setDefaults(dst, absent)
+			return nil
+		})
+	}
+}
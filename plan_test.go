@@ -0,0 +1,87 @@
+package sqldecoder
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/erikstmartin/go-testdb"
+)
+
+func TestPlanReusedForSameTypes(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	var first, second valueContainer
+	if err = d.Decode(&first); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	p := d.d.plan
+	if err = d.Decode(&second); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if d.d.plan != p {
+		t.Errorf("plan was recompiled for the same destination type")
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("got IDs %d and %d, expected 1 and 2", first.ID, second.ID)
+	}
+}
+
+func TestPlanRecompiledForNewTypes(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID", "Name"},
+		[]driver.Value{1, []byte("Ada")},
+		[]driver.Value{2, []byte("Grace")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type record struct {
+		ID   int64
+		Name string
+	}
+
+	d := NewDecoder(rows)
+	var r record
+	if err = d.Decode(&r); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	var m map[string]interface{}
+	if err = d.Decode(&m); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if r.ID != 1 || r.Name != "Ada" {
+		t.Errorf("got %+v, expected {ID:1 Name:Ada}", r)
+	}
+	if string(m["Name"].([]byte)) != "Grace" {
+		t.Errorf("got %v, expected Name to be Grace", m)
+	}
+}
+
+func TestPlanRecompiledForNewOptions(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	var v valueContainer
+	if err = d.Decode(&v); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	d.DisallowUnknownColumns()
+	if err = d.Decode(&v); err == nil {
+		t.Errorf("expected an error for the unknown columns")
+	}
+}
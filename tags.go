@@ -0,0 +1,144 @@
+package sqldecoder
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// tagOptionValues maps the name of each tag option to whether the option
+// takes a value.
+var tagOptionValues = map[string]bool{
+	"default":  true,
+	"nullzero": false,
+	"prefix":   true,
+	"required": false,
+	"rest":     false,
+}
+
+// A Tag is a parsed struct field tag.
+type Tag struct {
+	// Name is the column name. It is empty when the tag does not name a
+	// column.
+	Name string
+
+	// Ignore is true when the field is never mapped to a column.
+	Ignore bool
+
+	// Options maps the name of each option to its value. Options that do
+	// not take a value, such as nullzero, have an empty value.
+	Options map[string]string
+}
+
+// validate checks that each of tg's options is known and that options that do
+// not take a value have none.
+func (tg Tag) validate() error {
+	for key, value := range tg.Options {
+		takesValue, ok := tagOptionValues[key]
+		switch {
+		case !ok:
+			return errors.New("unknown option " + key)
+		case !takesValue && value != "":
+			return errors.New("option " + key + " does not take a value")
+		}
+	}
+	return nil
+}
+
+// A TagParser parses the tags of struct fields. The mapping of struct types is
+// only cached for implementations that are comparable.
+type TagParser interface {
+	// ParseTag parses a struct field's tag. The zero Tag is returned when
+	// the field has no tag.
+	ParseTag(tag reflect.StructTag) (Tag, error)
+}
+
+var (
+	// SQLTags parses sql tags. It is the default TagParser.
+	SQLTags = TagKey("sql")
+
+	// DBTags parses db tags, as used by sqlx. The tags have the same
+	// format as sql tags.
+	DBTags = TagKey("db")
+
+	// GormTags parses gorm tags.
+	GormTags TagParser = gormTagParser{}
+)
+
+// TagKey returns a TagParser that parses the tag with the given key. The tag is
+// a column name followed by options separated by commas, such as
+// `sql:"name,opt1,opt2=value"`. Options that take a value are followed by an
+// equals sign and the value. A tag of "-" causes the field to be ignored; use
+// "-," to map the field to a column named "-".
+func TagKey(key string) TagParser {
+	return tagKeyParser(key)
+}
+
+type tagKeyParser string
+
+func (key tagKeyParser) ParseTag(tag reflect.StructTag) (Tag, error) {
+	return parseTag(tag.Get(string(key)))
+}
+
+// parseTag parses a tag in the format described by TagKey.
+func parseTag(s string) (Tag, error) {
+	if s == "-" {
+		return Tag{Ignore: true}, nil
+	}
+
+	name, opts, _ := strings.Cut(s, ",")
+	tg := Tag{Name: name}
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(opt, "=")
+		if takesValue, ok := tagOptionValues[key]; ok && takesValue != hasValue {
+			if takesValue {
+				return Tag{}, errors.New("option " + key + " requires a value")
+			}
+			return Tag{}, errors.New("option " + key + " does not take a value")
+		}
+		if _, ok := tg.Options[key]; ok {
+			return Tag{}, errors.New("option " + key + " is repeated")
+		}
+
+		if tg.Options == nil {
+			tg.Options = make(map[string]string)
+		}
+		tg.Options[key] = value
+	}
+	return tg, nil
+}
+
+type gormTagParser struct{}
+
+// ParseTag parses a gorm tag, such as `gorm:"column:name;not null"`. The column
+// setting names the column, the "-" and "-:all" settings cause the field to be
+// ignored, and the embedded and embeddedPrefix settings map the fields of a
+// nested struct like the prefix option. Other settings, including "-:migration"
+// which does not stop gorm from reading the field, are ignored.
+func (gormTagParser) ParseTag(tag reflect.StructTag) (Tag, error) {
+	var tg Tag
+	for _, setting := range strings.Split(tag.Get("gorm"), ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(setting), ":")
+		switch strings.ToLower(key) {
+		case "-":
+			if value == "" || strings.EqualFold(value, "all") {
+				return Tag{Ignore: true}, nil
+			}
+		case "column":
+			tg.Name = value
+		case "embedded":
+			if _, ok := tg.Options["prefix"]; !ok {
+				tg.Options = map[string]string{"prefix": ""}
+			}
+		case "embeddedprefix":
+			tg.Options = map[string]string{"prefix": value}
+		}
+	}
+	return tg, nil
+}
@@ -0,0 +1,183 @@
+package sqldecoder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/erikstmartin/go-testdb"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected Tag
+	}{
+		{tag: "", expected: Tag{}},
+		{tag: "ID", expected: Tag{Name: "ID"}},
+		{tag: "-", expected: Tag{Ignore: true}},
+		{tag: "-,", expected: Tag{Name: "-"}},
+		{tag: "nickname,nullzero", expected: Tag{Name: "nickname", Options: map[string]string{"nullzero": ""}}},
+		{tag: ",prefix=billing_", expected: Tag{Options: map[string]string{"prefix": "billing_"}}},
+		{tag: "status,nullzero,default=active,", expected: Tag{Name: "status", Options: map[string]string{"nullzero": "", "default": "active"}}},
+	}
+
+	for _, tt := range tests {
+		actual, err := parseTag(tt.tag)
+		if err != nil {
+			t.Errorf("parseTag(%q) failed: %s", tt.tag, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("parseTag(%q), got %+v, expected %+v", tt.tag, actual, tt.expected)
+		}
+	}
+}
+
+func TestParseTagProvidesError(t *testing.T) {
+	tests := []string{
+		"ID,prefix",
+		"ID,nullzero=true",
+		"ID,default=1,default=2",
+	}
+
+	for _, tt := range tests {
+		if _, err := parseTag(tt); err == nil {
+			t.Errorf("parseTag(%q), expected error", tt)
+		}
+	}
+}
+
+func TestTagValidateProvidesError(t *testing.T) {
+	tests := []Tag{
+		{Name: "ID", Options: map[string]string{"omitempty": ""}},
+		{Name: "ID", Options: map[string]string{"nullzero": "true"}},
+	}
+
+	for _, tt := range tests {
+		if err := tt.validate(); err == nil {
+			t.Errorf("%+v.validate(), expected error", tt)
+		}
+	}
+}
+
+func TestGormTags(t *testing.T) {
+	tests := []struct {
+		tag      reflect.StructTag
+		expected Tag
+	}{
+		{tag: `json:"id"`, expected: Tag{}},
+		{tag: `gorm:"column:user_name;type:varchar(100);not null"`, expected: Tag{Name: "user_name"}},
+		{tag: `gorm:"-"`, expected: Tag{Ignore: true}},
+		{tag: `gorm:"-:all"`, expected: Tag{Ignore: true}},
+		{tag: `gorm:"column:user_name;-"`, expected: Tag{Ignore: true}},
+		{tag: `gorm:"-:migration"`, expected: Tag{}},
+		{tag: `gorm:"column:user_name;-:migration"`, expected: Tag{Name: "user_name"}},
+		{tag: `gorm:"embedded"`, expected: Tag{Options: map[string]string{"prefix": ""}}},
+		{tag: `gorm:"embedded;embeddedPrefix:billing_"`, expected: Tag{Options: map[string]string{"prefix": "billing_"}}},
+	}
+
+	for _, tt := range tests {
+		actual, err := GormTags.ParseTag(tt.tag)
+		if err != nil {
+			t.Errorf("ParseTag(%q) failed: %s", tt.tag, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("ParseTag(%q), got %+v, expected %+v", tt.tag, actual, tt.expected)
+		}
+	}
+}
+
+type compatibleTagsContainer struct {
+	Natural     int64  `db:"ID" gorm:"column:ID"`
+	Text        string `db:"Description" gorm:"column:Description"`
+	Description string `db:"-" gorm:"-"`
+}
+
+func TestDecodeTagParsers(t *testing.T) {
+	for _, p := range []TagParser{DBTags, GormTags} {
+		rows, err := stubRows()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		target := NewDecoder(rows)
+		target.SetTagParser(p)
+
+		expected := compatibleTagsContainer{Natural: 1, Text: "short and stout"}
+		var actual compatibleTagsContainer
+		if err = target.Decode(&actual); err != nil {
+			t.Errorf("Decode with %T failed: %s", p, err)
+		} else if actual != expected {
+			t.Errorf("%T: got %v, expected %v", p, actual, expected)
+		}
+		testdb.Reset()
+	}
+}
+
+func TestDecodeTagKey(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewDecoder(rows)
+	target.SetTagKey("col")
+
+	actual := &struct {
+		Natural int64 `col:"ID"`
+	}{}
+	if err = target.Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual.Natural != 1 {
+		t.Errorf("got %v, expected %v", actual.Natural, 1)
+	}
+}
+
+type ignoredFieldContainer struct {
+	ID          int64 `sql:"-"`
+	Description string
+}
+
+func TestDecodeIgnoredField(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := new(ignoredFieldContainer)
+	if err = NewDecoder(rows).Decode(actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if actual.ID != 0 {
+		t.Errorf("got %v, expected %v", actual.ID, 0)
+	}
+
+	if actual.Description != "short and stout" {
+		t.Errorf("got '%v', expected '%v'", actual.Description, "short and stout")
+	}
+}
+
+func TestDecodeUnknownTagOptionProvidesError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := &struct {
+		ID int64 `sql:"ID,omitempty"`
+	}{}
+	err = NewDecoder(rows).Decode(actual)
+	if _, ok := err.(tagError); !ok {
+		t.Fatalf("Decode(actual), got %v, expected tagError", err)
+	}
+}
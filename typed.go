@@ -0,0 +1,59 @@
+package sqldecoder
+
+import (
+	"io"
+	"iter"
+	"reflect"
+)
+
+// A TypedDecoder reads and decodes values of type T from rows. T is expected
+// to be a type that Decoder.Decode accepts a pointer to, or a pointer to such
+// a type.
+type TypedDecoder[T any] struct {
+	d *Decoder
+}
+
+// NewTypedDecoder returns a new decoder that reads values of type T from rows.
+func NewTypedDecoder[T any](rows Rows) *TypedDecoder[T] {
+	return &TypedDecoder[T]{d: NewDecoder(rows)}
+}
+
+// NewTypedDecoderFrom returns a new decoder that reads values of type T using
+// d, so that options set on d apply to the values it decodes.
+func NewTypedDecoderFrom[T any](d *Decoder) *TypedDecoder[T] {
+	return &TypedDecoder[T]{d: d}
+}
+
+// Next decodes the next row and returns it. When T is a pointer to a scalar
+// type, the value is nil for a NULL column.
+// Returns io.EOF if there are no more rows to decode.
+func (td *TypedDecoder[T]) Next() (T, error) {
+	var v T
+	var dst interface{} = &v
+	if rt := reflect.TypeFor[T](); rt.Kind() == reflect.Ptr && !isScalar(rt.Elem()) {
+		v = reflect.New(rt.Elem()).Interface().(T)
+		dst = v
+	}
+
+	if err := td.d.Decode(dst); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// All returns an iterator over the remaining rows. Iteration stops after the
+// first error, which is yielded along with the zero value of T.
+func (td *TypedDecoder[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			v, err := td.Next()
+			if err == io.EOF {
+				return
+			}
+			if !yield(v, err) || err != nil {
+				return
+			}
+		}
+	}
+}
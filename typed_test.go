@@ -0,0 +1,121 @@
+package sqldecoder
+
+import (
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/erikstmartin/go-testdb"
+)
+
+func TestTypedDecoderNext(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewTypedDecoder[taggedValueContainer](rows)
+	for i := 1; i <= 3; i++ {
+		actual, err := target.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %s", err)
+		}
+		if actual.Natural != int64(i) {
+			t.Errorf("got %v, expected %v", actual.Natural, i)
+		}
+	}
+
+	if _, err = target.Next(); err != io.EOF {
+		t.Errorf("Next(), got %v, expected %s", err, io.EOF)
+	}
+}
+
+func TestNewTypedDecoderFrom(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(rows)
+	target := NewTypedDecoderFrom[taggedValueContainer](d)
+	if _, err := target.Next(); err != nil {
+		t.Fatalf("Next failed: %s", err)
+	}
+	if _, err := target.Next(); err != nil {
+		t.Fatalf("Next failed: %s", err)
+	}
+
+	var actual taggedValueContainer
+	if err := d.Decode(&actual); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if actual.Natural != 3 {
+		t.Errorf("got %v, expected %v", actual.Natural, 3)
+	}
+}
+
+func TestTypedDecoderAll(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := 0
+	for actual, err := range NewTypedDecoder[*columnMappedContainer](rows).All() {
+		if err != nil {
+			t.Fatalf("All failed: %s", err)
+		}
+		i++
+		if actual.id != int64(i) {
+			t.Errorf("got %v, expected %v", actual.id, i)
+		}
+	}
+
+	if i != 3 {
+		t.Errorf("got %d rows, expected 3", i)
+	}
+}
+
+func TestTypedDecoderAllStopsOnError(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubMultipleRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for _, err := range NewTypedDecoder[int](rows).All() {
+		n++
+		if err == nil {
+			t.Errorf("All(), expected error")
+		}
+	}
+
+	if n != 1 {
+		t.Errorf("got %d values, expected 1", n)
+	}
+}
+
+func TestTypedDecoderScalarPointer(t *testing.T) {
+	defer testdb.Reset()
+
+	rows, err := stubQuery([]string{"ID"}, []driver.Value{nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := NewTypedDecoder[*int64](rows).Next()
+	if err != nil {
+		t.Fatalf("Next failed: %s", err)
+	}
+	if actual != nil {
+		t.Errorf("got %v, expected nil", *actual)
+	}
+}